@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Built-in result actions; any other name refers to a configured command.
+const (
+	actionOpen   = "open"
+	actionReveal = "reveal"
+	actionEdit   = "edit"
+)
+
+// hitCommand builds the command that carries out action on hit. Commands that
+// need the terminal, the editor and user-defined commands, are reported as
+// attached; the others are started in the background.
+func (a ResultActions) hitCommand(action string, hit searchHit) (cmd *exec.Cmd, attached bool, err error) {
+	path := hitPath(hit)
+
+	switch action {
+	case actionOpen:
+		if a.Open != "" {
+			cmd, err = templateCommand(a.Open, hit)
+			return cmd, false, err
+		}
+		name, args := defaultOpenCommand(path)
+		return exec.Command(name, args...), false, nil
+
+	case actionReveal:
+		if a.Reveal != "" {
+			cmd, err = templateCommand(a.Reveal, hit)
+			return cmd, false, err
+		}
+		name, args := revealCommand(path)
+		return exec.Command(name, args...), false, nil
+
+	case actionEdit:
+		cmd, err = a.editorCommand(hit)
+		return cmd, true, err
+	}
+
+	for _, command := range a.Commands {
+		if command.Name == action {
+			cmd, err = templateCommand(command.Command, hit)
+			return cmd, true, err
+		}
+	}
+	return nil, false, fmt.Errorf("unknown action %q", action)
+}
+
+// runHitAction carries out action on hit from a plain terminal.
+func runHitAction(actions ResultActions, action string, hit searchHit) error {
+	cmd, attached, err := actions.hitCommand(action, hit)
+	if err != nil {
+		return err
+	}
+	if !attached {
+		return cmd.Start()
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// commandForKey returns the configured command bound to key in the browser.
+func (a ResultActions) commandForKey(key string) (string, bool) {
+	for _, command := range a.Commands {
+		if command.Key != "" && command.Key == key {
+			return command.Name, true
+		}
+	}
+	return "", false
+}
+
+// actionNames lists the names accepted after a result number at the prompt.
+func (a ResultActions) actionNames() []string {
+	var names []string
+	for _, command := range a.Commands {
+		names = append(names, command.Name)
+	}
+	return names
+}
+
+// stdin is shared by every prompt, so input buffered by one answer is not
+// lost to the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readResponse reads a whole line answered at a prompt, spaces included,
+// without its line ending.
+func readResponse() string {
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// parseHitChoice reads a prompt answer such as "3", "3r", "3 e" or
+// "3 preview" into a result number and an action.
+func parseHitChoice(response string) (int, string, bool) {
+	response = strings.TrimSpace(response)
+	digits := strings.IndexFunc(response, func(r rune) bool { return !unicode.IsDigit(r) })
+	if digits < 0 {
+		digits = len(response)
+	}
+
+	choice, err := strconv.Atoi(response[:digits])
+	if err != nil {
+		return 0, "", false
+	}
+
+	switch action := strings.TrimSpace(response[digits:]); action {
+	case "", "o":
+		return choice, actionOpen, true
+	case "r":
+		return choice, actionReveal, true
+	case "e":
+		return choice, actionEdit, true
+	default:
+		return choice, action, true
+	}
+}
+
+// editorCommand opens the hit in the configured editor, $VISUAL or $EDITOR,
+// at the line of the matched passage when the editor's syntax for it is
+// known. An editor setting containing placeholders is used as a template.
+func (a ResultActions) editorCommand(hit searchHit) (*exec.Cmd, error) {
+	editor := a.Editor
+	if strings.Contains(editor, "{") {
+		return templateCommand(editor, hit)
+	}
+	if editor == "" {
+		var err error
+		if editor, err = findEditor(); err != nil {
+			return nil, err
+		}
+	}
+
+	args, err := splitArgs(editor)
+	if err != nil || len(args) == 0 {
+		return nil, fmt.Errorf("invalid editor %q", editor)
+	}
+
+	path := hitPath(hit)
+	line, _ := hitLocation(hit)
+	if line == 0 {
+		return exec.Command(args[0], append(args[1:], path)...), nil
+	}
+
+	switch strings.TrimSuffix(filepath.Base(args[0]), ".exe") {
+	case "code", "code-insiders", "codium", "cursor":
+		args = append(args, "--goto", fmt.Sprintf("%s:%d", path, line))
+	case "subl", "zed", "hx", "helix":
+		args = append(args, fmt.Sprintf("%s:%d", path, line))
+	default:
+		// vi, vim, nvim, nano, emacs, micro, kak and most others
+		args = append(args, fmt.Sprintf("+%d", line), path)
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// findEditor returns $VISUAL, $EDITOR or the first common editor installed.
+func findEditor() (string, error) {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); editor != "" {
+			return editor, nil
+		}
+	}
+
+	for _, editor := range []string{"nano", "vim", "vi", "notepad", "code", "gedit"} {
+		if path, err := exec.LookPath(editor); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no editor found, please set the EDITOR environment variable")
+}
+
+// hitLocation returns the 1-based line and PDF page of the hit's matched
+// passage, 0 when unknown. Lines are only counted in text files, whose chunk
+// offsets are byte offsets into the file.
+func hitLocation(hit searchHit) (line, page int) {
+	passage := hit.Passage
+	if passage == nil {
+		return 0, 0
+	}
+	if passage.Page > 0 {
+		return 0, passage.Page
+	}
+
+	file, err := os.Open(hitPath(hit))
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	head, err := io.ReadAll(io.LimitReader(file, int64(passage.Offset)))
+	if err != nil {
+		return 0, 0
+	}
+	return bytes.Count(head, []byte("\n")) + 1, 0
+}
+
+// templateCommand expands a command template for hit. Placeholders are
+// replaced inside each argument, so paths with spaces stay one argument.
+func templateCommand(template string, hit searchHit) (*exec.Cmd, error) {
+	args, err := splitArgs(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command %q : %w", template, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	line, page := hitLocation(hit)
+	replacer := strings.NewReplacer(
+		"{path}", hitPath(hit),
+		"{dir}", hit.File.Directory,
+		"{name}", hit.File.Name,
+		"{id}", strconv.Itoa(hit.File.Id),
+		"{line}", strconv.Itoa(max(line, 1)),
+		"{page}", strconv.Itoa(max(page, 1)),
+	)
+
+	placeholder := false
+	for i, arg := range args {
+		if expanded := replacer.Replace(arg); expanded != arg {
+			args[i] = expanded
+			placeholder = true
+		}
+	}
+	if !placeholder {
+		args = append(args, hitPath(hit))
+	}
+
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// revealCommand shows path selected in the system file manager. Linux file
+// managers are asked over D-Bus; without it the folder is opened instead.
+func revealCommand(path string) (string, []string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open", []string{"-R", path}
+	case "windows":
+		return "explorer", []string{"/select," + path}
+	}
+
+	if _, err := exec.LookPath("dbus-send"); err == nil {
+		return "dbus-send", []string{"--session", "--dest=org.freedesktop.FileManager1", "--type=method_call",
+			"/org/freedesktop/FileManager1", "org.freedesktop.FileManager1.ShowItems",
+			"array:string:" + (&url.URL{Scheme: "file", Path: path}).String(), "string:"}
+	}
+	return defaultOpenCommand(filepath.Dir(path))
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+)
+
+const defaultAskSources = 5
+
+type askOpts struct {
+	Sources int
+}
+
+// askCmd answers a question from the content of the most relevant indexed
+// files, streaming the answer and listing the files it was given.
+func askCmd(args []string, opts *askOpts) error {
+	question := strings.TrimSpace(strings.Join(args, " "))
+	if question == "" {
+		return fmt.Errorf("no question provided")
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config : %w", err)
+	}
+	if len(config.APIKeys) == 0 {
+		return fmt.Errorf("no apikeys provided")
+	}
+
+	sourceCount := opts.Sources
+	if sourceCount <= 0 {
+		sourceCount = defaultAskSources
+	}
+
+	hits, warnings, err := searchFiles(question, &searchOpts{Limit: sourceCount, Nearest: true})
+	printWarnings(warnings)
+	if errors.Is(err, gemini.ErrNoConfidentMatch) {
+		fmt.Println(fileinfo.Yellow("No file matches confidently; answering from the nearest candidates"))
+	} else if err != nil {
+		return err
+	}
+
+	sources := make([]gemini.AskSource, len(hits))
+	for i, hit := range hits {
+		sources[i] = gemini.AskSource{File: hit.File, Passage: hit.Passage}
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	spinner := fileinfo.NewSpinner(5, time.Second, writer)
+	fmt.Println()
+	spinner.Start()
+
+	responseIterator, err := gemini.AnswerQuestion(question, sources, config.APIKeys[0])
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
+	started := false
+	for {
+		response, err := responseIterator.Next()
+		if !started {
+			spinner.Stop()
+			started = true
+		}
+		if err != nil {
+			if !errors.Is(err, iterator.Done) {
+				fmt.Print(fileinfo.Red(err.Error()))
+			}
+			break
+		}
+		for _, candidate := range response.Candidates {
+			if candidate.Content == nil {
+				continue
+			}
+			for _, part := range candidate.Content.Parts {
+				fmt.Fprintf(writer, "%s", part)
+				writer.Flush()
+			}
+		}
+	}
+
+	fmt.Printf("\n\n%s\n", fileinfo.Yellow("Sources consulted :"))
+	for i, hit := range hits {
+		fmt.Printf("  %s %s\n", fileinfo.Cyan(fmt.Sprintf("[%d]", i+1)), filepath.Join(hit.File.Directory, hit.File.Name))
+	}
+
+	return nil
+}
@@ -0,0 +1,410 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+const maxPreviewSnippet = 1500
+
+var (
+	browserTitleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	browserWarnStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+	browserSelectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	browserDimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	browserLabelStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	browserPaneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+)
+
+// canBrowse reports whether results can be shown in the full-screen browser,
+// which needs an interactive terminal on both ends.
+func canBrowse() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// browseResults shows hits in a full-screen browser with a preview pane.
+// The query can be refined and re-run from inside the browser with opts.
+// Warnings from the search are shown in the status line.
+func browseResults(query string, opts *searchOpts, hits []searchHit, warnings []string, searchErr error) error {
+	input := textinput.New()
+	input.Prompt = "/ "
+	input.SetValue(query)
+
+	model := &resultBrowser{
+		query:    query,
+		opts:     opts,
+		hits:     hits,
+		nearest:  errors.Is(searchErr, gemini.ErrNoConfidentMatch),
+		input:    input,
+		snippets: make(map[string]string),
+		actions:  resultActions(),
+		status:   strings.Join(warnings, "; "),
+	}
+
+	_, err := tea.NewProgram(model, tea.WithAltScreen()).Run()
+	return err
+}
+
+// resultBrowser is the bubbletea model of the search result browser.
+type resultBrowser struct {
+	query   string
+	opts    *searchOpts
+	hits    []searchHit
+	nearest bool
+	cursor  int
+	offset  int
+
+	input     textinput.Model
+	refining  bool
+	searching bool
+
+	// Extracted text previews by path; "" while loading
+	snippets map[string]string
+	status   string
+
+	actions ResultActions
+
+	width, height int
+}
+
+type snippetMsg struct {
+	path string
+	text string
+}
+
+// actionDoneMsg reports the end of an action that took over the terminal.
+type actionDoneMsg struct {
+	status string
+}
+
+type searchDoneMsg struct {
+	query    string
+	hits     []searchHit
+	warnings []string
+	err      error
+}
+
+func (m *resultBrowser) Init() tea.Cmd {
+	return m.loadSnippet()
+}
+
+func (m *resultBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case snippetMsg:
+		m.snippets[msg.path] = msg.text
+		return m, nil
+
+	case actionDoneMsg:
+		m.status = msg.status
+		return m, nil
+
+	case searchDoneMsg:
+		m.searching = false
+		if msg.err != nil && !errors.Is(msg.err, gemini.ErrNoConfidentMatch) {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		m.query, m.hits, m.nearest = msg.query, msg.hits, errors.Is(msg.err, gemini.ErrNoConfidentMatch)
+		m.cursor, m.offset = 0, 0
+		m.status = strings.Join(append([]string{fmt.Sprintf("%d results", len(m.hits))}, msg.warnings...), "; ")
+		return m, m.loadSnippet()
+
+	case tea.KeyMsg:
+		if m.refining {
+			return m.updateRefine(msg)
+		}
+		return m.updateBrowse(msg)
+	}
+
+	return m, nil
+}
+
+func (m *resultBrowser) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc", "ctrl+c":
+		return m, tea.Quit
+
+	case "up", "k":
+		return m, m.moveCursor(-1)
+	case "down", "j":
+		return m, m.moveCursor(1)
+	case "pgup":
+		return m, m.moveCursor(-m.listHeight())
+	case "pgdown":
+		return m, m.moveCursor(m.listHeight())
+	case "home", "g":
+		return m, m.moveCursor(-len(m.hits))
+	case "end", "G":
+		return m, m.moveCursor(len(m.hits))
+
+	case "enter", "o":
+		return m, m.runAction(actionOpen)
+	case "r":
+		return m, m.runAction(actionReveal)
+	case "e":
+		return m, m.runAction(actionEdit)
+	case "c", "y":
+		if hit, ok := m.selected(); ok {
+			termenv.Copy(hitPath(hit))
+			m.status = "Copied " + hitPath(hit)
+		}
+
+	case "/":
+		m.refining = true
+		m.input.CursorEnd()
+		return m, m.input.Focus()
+
+	default:
+		if name, ok := m.actions.commandForKey(msg.String()); ok {
+			return m, m.runAction(name)
+		}
+	}
+
+	return m, nil
+}
+
+// runAction carries out action on the selected hit. Actions that need the
+// terminal, like the editor, suspend the browser until they exit.
+func (m *resultBrowser) runAction(action string) tea.Cmd {
+	hit, ok := m.selected()
+	if !ok {
+		return nil
+	}
+
+	cmd, attached, err := m.actions.hitCommand(action, hit)
+	if err != nil {
+		m.status = actionStatus(action, hit, err)
+		return nil
+	}
+	if !attached {
+		m.status = actionStatus(actionDone(action), hit, cmd.Start())
+		return nil
+	}
+
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return actionDoneMsg{status: actionStatus(actionDone(action), hit, err)}
+	})
+}
+
+func (m *resultBrowser) updateRefine(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.refining = false
+		m.input.SetValue(m.query)
+		m.input.Blur()
+		return m, nil
+	case "enter":
+		query := strings.TrimSpace(m.input.Value())
+		m.refining = false
+		m.input.Blur()
+		if query == "" || m.searching {
+			return m, nil
+		}
+		m.searching = true
+		m.status = "Searching..."
+		opts := m.opts
+		return m, func() tea.Msg {
+			hits, warnings, err := searchFiles(query, opts)
+			return searchDoneMsg{query: query, hits: hits, warnings: warnings, err: err}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *resultBrowser) moveCursor(delta int) tea.Cmd {
+	if len(m.hits) == 0 {
+		return nil
+	}
+	m.cursor = max(0, min(m.cursor+delta, len(m.hits)-1))
+
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if height := m.listHeight(); m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+	return m.loadSnippet()
+}
+
+func (m *resultBrowser) selected() (searchHit, bool) {
+	if m.cursor >= len(m.hits) {
+		return searchHit{}, false
+	}
+	return m.hits[m.cursor], true
+}
+
+// loadSnippet extracts the start of the selected file's text in the
+// background, once per file.
+func (m *resultBrowser) loadSnippet() tea.Cmd {
+	hit, ok := m.selected()
+	if !ok {
+		return nil
+	}
+	path := hitPath(hit)
+	if _, loading := m.snippets[path]; loading {
+		return nil
+	}
+	m.snippets[path] = ""
+
+	file := hit.File
+	return func() tea.Msg {
+		pages, err := gemini.ExtractText(file)
+		if err != nil {
+			return snippetMsg{path: path, text: "(no text preview)"}
+		}
+
+		var text strings.Builder
+		for _, page := range pages {
+			text.WriteString(page.Text)
+			text.WriteString("\n")
+			if text.Len() > maxPreviewSnippet {
+				break
+			}
+		}
+		snippet := strings.TrimSpace(text.String())
+		if len(snippet) > maxPreviewSnippet {
+			snippet = strings.ToValidUTF8(snippet[:maxPreviewSnippet], "") + "..."
+		}
+		if snippet == "" {
+			snippet = "(no text preview)"
+		}
+		return snippetMsg{path: path, text: snippet}
+	}
+}
+
+// listHeight is the number of result rows that fit on screen.
+func (m *resultBrowser) listHeight() int {
+	return max(1, m.height-6)
+}
+
+func (m *resultBrowser) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	title := browserTitleStyle.Render(fmt.Sprintf("Results for %q", m.query))
+	if m.nearest {
+		title = browserWarnStyle.Render(fmt.Sprintf("No confident match for %q. Nearest candidates", m.query))
+	}
+
+	listWidth := max(24, m.width*2/5)
+	previewWidth := max(20, m.width-listWidth-4)
+	paneHeight := m.listHeight()
+
+	list := browserPaneStyle.Width(listWidth - 2).Height(paneHeight).Render(m.listView(listWidth - 4))
+	preview := browserPaneStyle.Width(previewWidth - 2).Height(paneHeight).Render(m.previewView(previewWidth-4, paneHeight))
+
+	footer := browserDimStyle.Render("↑/↓ move • enter open • r reveal • e edit • c copy path • / refine query • q quit")
+	if m.refining {
+		footer = m.input.View()
+	} else if m.status != "" {
+		footer = m.status + "  " + footer
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, title, lipgloss.JoinHorizontal(lipgloss.Top, list, preview), footer)
+}
+
+func (m *resultBrowser) listView(width int) string {
+	if len(m.hits) == 0 {
+		return browserDimStyle.Render("No results")
+	}
+
+	var rows []string
+	end := min(len(m.hits), m.offset+m.listHeight())
+	for i := m.offset; i < end; i++ {
+		hit := m.hits[i]
+		marker := " "
+		if hit.New {
+			marker = "+"
+		}
+		row := fmt.Sprintf("%2d%s%s %s", i+1, marker, hitScore(hit), hit.File.Name)
+		if len(row) > width {
+			row = strings.ToValidUTF8(row[:width-1], "") + "…"
+		}
+		if i == m.cursor {
+			row = browserSelectedStyle.Render(row)
+		}
+		rows = append(rows, row)
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (m *resultBrowser) previewView(width, height int) string {
+	hit, ok := m.selected()
+	if !ok {
+		return ""
+	}
+	file := hit.File
+	wrap := lipgloss.NewStyle().Width(width)
+
+	var sections []string
+	sections = append(sections, browserSelectedStyle.Render(file.Name))
+	sections = append(sections, browserDimStyle.Render(hitPath(hit)))
+	sections = append(sections, browserDimStyle.Render(fmt.Sprintf("%s • modified %s • %s", fileinfo.FormatSize(file.Size), file.ModifiedTime.Format("2006-01-02 15:04"), hitScore(hit))))
+	sections = append(sections, "", browserLabelStyle.Render("Description"), wrap.Render(strings.Join(strings.Fields(file.Description), " ")))
+
+	if hit.Reason != "" {
+		sections = append(sections, "", browserLabelStyle.Render("Why"), wrap.Render(hit.Reason))
+	}
+	if hit.Passage != nil {
+		sections = append(sections, "", browserLabelStyle.Render("Matched passage"), wrap.Render(passageSummary(hit.Passage)))
+	} else if snippet := m.snippets[hitPath(hit)]; snippet != "" {
+		sections = append(sections, "", browserLabelStyle.Render("Preview"), wrap.Render(snippet))
+	}
+
+	lines := strings.Split(strings.Join(sections, "\n"), "\n")
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hitPath(hit searchHit) string {
+	return filepath.Join(hit.File.Directory, hit.File.Name)
+}
+
+func hitScore(hit searchHit) string {
+	if hit.KeywordScore > 0 && hit.Similarity == 0 {
+		return fmt.Sprintf("k%.1f", hit.KeywordScore)
+	}
+	return fmt.Sprintf("%.2f", hit.Relevance)
+}
+
+// actionDone describes a finished action in the status line.
+func actionDone(action string) string {
+	switch action {
+	case actionOpen:
+		return "Opened"
+	case actionReveal:
+		return "Revealed"
+	case actionEdit:
+		return "Edited"
+	}
+	return "Ran " + action + " on"
+}
+
+func actionStatus(action string, hit searchHit, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Failed : %v", err)
+	}
+	return fmt.Sprintf("%s %s", action, hit.File.Name)
+}
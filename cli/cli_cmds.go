@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
 	"os"
 	"os/exec"
 	"strings"
@@ -79,11 +80,11 @@ func (c *systemCommand) run(message string) bool {
 		} else if strings.HasPrefix(message, systemCmdIndex) {
 			hashSet := fileinfo.NewHashSet() // Initialize the hash set
 			// Load the hash set from file at the start
-			if err := hashSet.LoadFromFile(); err != nil {
+			if err := hashSet.Load(); err != nil {
 				return true
 			}
 
-			err := indexFiles(hashSet)
+			err := indexFiles(hashSet, &indexOpts{})
 			// spinners.stop()
 			if err != nil {
 				c.print(err.Error())
@@ -92,25 +93,52 @@ func (c *systemCommand) run(message string) bool {
 			}
 
 		} else if strings.HasPrefix(message, systemCmdSearch) {
-			query := strings.TrimPrefix(message, systemCmdSetStyle+" ")
-			file, err := searchFiles(query)
-			// spinners.stop()
+			query, searchOptions, err := parseSearchCommand(strings.TrimPrefix(message, systemCmdSearch))
+			if err != nil {
+				c.print(err.Error())
+				return false
+			}
 
+			format, err := searchOptions.outputFormat()
 			if err != nil {
 				c.print(err.Error())
+				return false
+			}
+
+			hits, warnings, err := searchFiles(query, searchOptions)
+			printWarnings(warnings)
+			// spinners.stop()
+
+			if err != nil && !errors.Is(err, gemini.ErrNoConfidentMatch) {
+				c.print(err.Error())
+				return false
+			}
+
+			recordSearch(query, searchOptions.searchFilters, hits)
+			if format != "" {
+				if err := writeHits(os.Stdout, hits, format, searchOptions.NullSeparated, err == nil); err != nil {
+					c.print(err.Error())
+				}
 			} else {
-				c.print("Most relevant file is : ")
-				c.print(fmt.Sprintf("\nFile : %s\nDirectory : %s\nDescription : %s\n", file.Name, file.Directory, file.Description))
-				c.print(("Do you want to open this file? (y/n): "))
-
-				var response string
-				fmt.Scanln(&response)
-
-				if strings.ToLower(response) == "y" {
-					err = OpenFileWithDefaultApp(file.Directory)
-					if err != nil {
-						c.print(fmt.Sprintf("Failed to open file: %v", err))
-					}
+				if err != nil {
+					c.print("No confident match. Nearest candidates : ")
+				} else {
+					c.print("Most relevant files are : ")
+				}
+				fmt.Print(formatSearchHits(hits))
+				if len(hits) == 0 {
+					return false
+				}
+				actions := resultActions()
+				c.print(hitPrompt(len(hits), actions))
+
+				// Read through readline, which owns the terminal during chat
+				c.chat.reader.SetPrompt("")
+				response, _ := c.chat.reader.Readline()
+				c.chat.reader.SetPrompt(c.chat.prompt.User)
+
+				if err := openSelectedHit(hits, actions, response); err != nil {
+					c.print(fmt.Sprintf("Failed to open file: %v", err))
 				}
 			}
 
@@ -128,28 +156,26 @@ func (c *systemCommand) print(message string) {
 
 // OpenFileWithDefaultApp opens the file with the default application based on OS.
 func OpenFileWithDefaultApp(path string) error {
-	var cmd string
-	var args []string
+	cmd, args := defaultOpenCommand(path)
+	return execCommand(cmd, args...)
+}
 
+// defaultOpenCommand returns the command that opens path with its default
+// application.
+func defaultOpenCommand(path string) (string, []string) {
 	switch {
 	case strings.Contains(strings.ToLower(os.Getenv("OS")), "windows"):
-		cmd = "cmd"
-		args = []string{"/c", "start", "", path}
+		return "cmd", []string{"/c", "start", "", path}
 	case strings.Contains(strings.ToLower(os.Getenv("XDG_SESSION_TYPE")), "wayland") ||
 		strings.Contains(strings.ToLower(os.Getenv("XDG_SESSION_TYPE")), "x11") ||
 		os.Getenv("DISPLAY") != "":
-		cmd = "xdg-open"
-		args = []string{path}
+		return "xdg-open", []string{path}
 	case os.Getenv("TERM_PROGRAM") == "Apple_Terminal" || os.Getenv("OSTYPE") == "darwin":
-		cmd = "open"
-		args = []string{path}
+		return "open", []string{path}
 	default:
 		// Try xdg-open as a fallback
-		cmd = "xdg-open"
-		args = []string{path}
+		return "xdg-open", []string{path}
 	}
-
-	return execCommand(cmd, args...)
 }
 
 func execCommand(name string, arg ...string) error {
@@ -3,8 +3,10 @@ package cli
 import (
 	"fmt"
 	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var opts chatOpts
@@ -21,6 +23,7 @@ func NewConfigCommand() *cobra.Command {
 	var addAPIKeys []string
 	var deleteAPIKeys []string
 	var fileEdit bool
+	var embeddingModel string
 
 	cmd := &cobra.Command{
 		Use:   "config",
@@ -44,7 +47,7 @@ func NewConfigCommand() *cobra.Command {
 				return nil
 			}
 
-			return setConfig(addDirectories, deleteDirectories, addSkipTypes, deleteSkipTypes, addSkipFiles, deleteSkipFiles, addAPIKeys, deleteAPIKeys, relevanceIndex)
+			return setConfig(addDirectories, deleteDirectories, addSkipTypes, deleteSkipTypes, addSkipFiles, deleteSkipFiles, addAPIKeys, deleteAPIKeys, relevanceIndex, embeddingModel)
 		},
 	}
 
@@ -54,49 +57,273 @@ func NewConfigCommand() *cobra.Command {
 	cmd.Flags().StringSliceVar(&deleteSkipTypes, "del-skiptypes", []string{}, "List of file types to stop skipping during indexing")
 	cmd.Flags().StringSliceVar(&addSkipFiles, "add-skipfiles", []string{}, "List of files to skip during indexing")
 	cmd.Flags().StringSliceVar(&deleteSkipFiles, "del-skipfiles", []string{}, "List of files to stop skipping during indexing")
-	cmd.Flags().Float32VarP(&relevanceIndex, "relindex", "r", 0.8, "Relevance Value used during Indexing")
+	cmd.Flags().Float32VarP(&relevanceIndex, "relindex", "r", 0, "Minimum calibrated relevance (0-1) for search results")
 	cmd.Flags().BoolVarP(&showConfig, "show-config", "s", false, "Show the current configuration")
 	cmd.Flags().StringSliceVar(&addAPIKeys, "add-apikeys", []string{}, "List of API keys to add")
 	cmd.Flags().StringSliceVar(&deleteAPIKeys, "del-apikeys", []string{}, "List of API keys to remove")
 	cmd.Flags().BoolVarP(&fileEdit, "edit", "e", false, "Open the configuration file in an editor")
+	cmd.Flags().StringVar(&embeddingModel, "embedding-model", "", "Embedding model used for indexing and search (default \""+gemini.DefaultEmbeddingModel+"\")")
 
 	return cmd
 }
 
 func NewIndexCommand(hs *fileinfo.HashSet) *cobra.Command {
+	var indexOptions indexOpts
 
 	cmd := &cobra.Command{
 		Use:   "index",
 		Short: "Index files in the configured directories",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return indexFilesCmd(hs)
+			return indexFilesCmd(hs, &indexOptions)
 		},
 	}
 
+	cmd.Flags().BoolVar(&indexOptions.RetryMetadata, "retry-metadata", false, "Retry blocked or empty descriptions using only the file's metadata")
+	cmd.Flags().BoolVar(&indexOptions.Reembed, "reembed", false, "Regenerate embeddings made by a different embedding model from the existing descriptions")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List indexed files whose descriptions were blocked, empty or failed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return indexStatusCmd()
+		},
+	})
+
+	var checkOnly bool
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the index database to the current schema",
+		Long: `Upgrade the index database to the schema of this version of gencli.
+
+Any command using the index upgrades it automatically; this runs the upgrade on its own,
+or with --check reports the pending migrations and exits with an error if there are any.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return indexMigrateCmd(checkOnly)
+		},
+	}
+	migrateCmd.Flags().BoolVar(&checkOnly, "check", false, "Report pending migrations without applying them")
+	cmd.AddCommand(migrateCmd)
+
 	return cmd
 }
 
 func NewSearchCommand() *cobra.Command {
 
 	var allFileDisplay bool
+	var showHistory bool
+	var searchOptions searchOpts
 
 	cmd := &cobra.Command{
 		Use:   "search",
 		Short: "Search files based on the provided query.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Failures past flag parsing are not usage mistakes
+			cmd.SilenceUsage = true
+
 			if allFileDisplay {
-				return displayAllFiles()
-			} else {
-				return searchFilesCmd(cmd, args)
+				return displayAllFiles(&searchOptions)
+			} else if showHistory {
+				return searchHistoryCmd(&searchOptions)
+			}
+
+			switch savedSearchAlias(args, cmd.ArgsLenAtDash()) {
+			case "save":
+				return saveSearchCmd(args[1], joinQueryArgs(args[2:]), searchOptions.searchFilters)
+			case "run":
+				return runSavedSearchCmd(args[1], &searchOptions)
 			}
+			return searchFilesCmd(cmd, args, &searchOptions)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&allFileDisplay, "all", "a", false, "Display Name and Description of All Indexed files")
+	cmd.Flags().BoolVar(&showHistory, "history", false, "List recent searches and run one of them again")
+	cmd.Flags().BoolVar(&searchOptions.NoBrowser, "no-browser", false, "Print a numbered list instead of opening the interactive result browser")
+	cmd.Flags().BoolVar(&searchOptions.NonInteractive, "non-interactive", false, "Print the results and exit without prompting")
+	addSearchFlags(cmd.Flags(), &searchOptions)
+
+	return cmd
+}
+
+// NewSearchesCommand manages saved searches. It is separate from search so
+// that no query is ever taken for a subcommand name; search still accepts
+// 'search save' and 'search run' as shorthands (see savedSearchAlias).
+func NewSearchesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "searches",
+		Short: "Save, run and list named searches",
+	}
+
+	cmd.AddCommand(newSaveSearchCommand(), newRunSavedSearchCommand(), newListSavedSearchesCommand())
+
+	return cmd
+}
+
+func newSaveSearchCommand() *cobra.Command {
+	var filters searchFilters
+
+	cmd := &cobra.Command{
+		Use:   "save <name> <query>",
+		Short: "Save a query and its filters under a name",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return saveSearchCmd(args[0], joinQueryArgs(args[1:]), filters)
+		},
+	}
+
+	addFilterFlags(cmd.Flags(), &filters)
+
+	return cmd
+}
+
+func newRunSavedSearchCommand() *cobra.Command {
+	var searchOptions searchOpts
+
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a saved search, marking results that are new since its last run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return runSavedSearchCmd(args[0], &searchOptions)
+		},
+	}
+
+	cmd.Flags().BoolVar(&searchOptions.NoBrowser, "no-browser", false, "Print a numbered list instead of opening the interactive result browser")
+	cmd.Flags().BoolVar(&searchOptions.NonInteractive, "non-interactive", false, "Print the results and exit without prompting")
+	addSearchFlags(cmd.Flags(), &searchOptions)
+
+	return cmd
+}
+
+func newListSavedSearchesCommand() *cobra.Command {
+	var deleteName string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List saved searches",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return savedSearchesCmd(deleteName)
+		},
+	}
+
+	cmd.Flags().StringVar(&deleteName, "delete", "", "Delete the saved search with this name")
+
+	return cmd
+}
+
+func NewSimilarCommand() *cobra.Command {
+	var similarOptions similarOpts
+
+	cmd := &cobra.Command{
+		Use:   "similar <path|#id>",
+		Short: "List indexed files similar to the given file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Failures past flag parsing are not usage mistakes
+			cmd.SilenceUsage = true
+			return similarFilesCmd(args[0], &similarOptions)
+		},
+	}
+
+	cmd.Flags().IntVarP(&similarOptions.Limit, "limit", "n", defaultSearchLimit, "Maximum number of results to show")
+	cmd.Flags().BoolVar(&similarOptions.NonInteractive, "non-interactive", false, "Print the results and exit without prompting")
+	addOutputFlags(cmd.Flags(), &similarOptions.outputOpts)
+
+	return cmd
+}
+
+func NewDupesCommand() *cobra.Command {
+	var dupesOptions dupesOpts
+
+	cmd := &cobra.Command{
+		Use:   "dupes",
+		Short: "Report duplicate and near-duplicate indexed files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dupesCmd(&dupesOptions)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dupesOptions.ExactOnly, "exact-only", false, "Only report files with identical content")
+	cmd.Flags().Float32Var(&dupesOptions.MinSimilarity, "min-similarity", defaultDupeSimilarity, "Minimum embedding similarity (0-1) for near duplicates, 0 to disable")
+	cmd.Flags().Float64Var(&dupesOptions.MinOverlap, "min-overlap", defaultDupeOverlap, "Minimum share of shared text (0-1) for near duplicates, 0 to disable")
+	cmd.Flags().BoolVar(&dupesOptions.Quantized, "quantized", false, "Pre-screen embedding pairs as int8 vectors, which keeps more of a large index in cache")
+	cmd.Flags().StringVar(&dupesOptions.JSONPath, "json", "", "Write the report as JSON to this file (\"-\" for stdout)")
+
+	return cmd
+}
+
+func NewOrganizeCommand(hs *fileinfo.HashSet) *cobra.Command {
+	var organizeOptions organizeOpts
+
+	cmd := &cobra.Command{
+		Use:   "organize <dir>",
+		Short: "Sort the indexed files of a directory into folders proposed by the model",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return organizeCmd(hs, args, &organizeOptions)
+		},
+	}
+
+	cmd.Flags().IntVarP(&organizeOptions.Groups, "groups", "g", 0, "Number of folders to create (default: based on the number of files)")
+	cmd.Flags().BoolVarP(&organizeOptions.Recursive, "recursive", "R", false, "Include files in subdirectories")
+	cmd.Flags().BoolVar(&organizeOptions.DryRun, "dry-run", false, "Show the plan without moving anything")
+	cmd.Flags().BoolVarP(&organizeOptions.Yes, "yes", "y", false, "Apply the plan without asking for confirmation")
+	cmd.Flags().BoolVar(&organizeOptions.Undo, "undo", false, "Restore the layout from before the last applied plan")
+
+	return cmd
+}
+
+func NewAskCommand() *cobra.Command {
+	var askOptions askOpts
+
+	cmd := &cobra.Command{
+		Use:   "ask <question>",
+		Short: "Answer a question from the content of the indexed files, citing them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return askCmd(args, &askOptions)
+		},
+	}
+
+	cmd.Flags().IntVarP(&askOptions.Sources, "sources", "n", defaultAskSources, "Number of relevant files to read before answering")
 
 	return cmd
 }
 
+// addSearchFlags registers the ranking and filter flags shared by the search
+// command and chat's $search.
+func addSearchFlags(flags *pflag.FlagSet, opts *searchOpts) {
+	flags.IntVarP(&opts.Limit, "limit", "n", defaultSearchLimit, "Maximum number of results to show")
+	flags.Float32Var(&opts.MinScore, "min-score", 0, "Minimum relevance (0-1) for a result, overriding the configured relevance index")
+	flags.BoolVar(&opts.Nearest, "nearest", false, "Show the nearest candidates when there is no confident match")
+	flags.BoolVar(&opts.KeywordOnly, "keyword-only", false, "Rank by keyword matches on names, paths and descriptions only")
+	flags.BoolVar(&opts.VectorOnly, "vector-only", false, "Rank by embedding similarity only")
+	flags.BoolVar(&opts.Rerank, "rerank", false, "Have the chat model re-order the top results and explain each one")
+	flags.IntVar(&opts.RerankTop, "rerank-top", defaultRerankTop, "Number of top results sent for re-ranking")
+
+	addOutputFlags(flags, &opts.outputOpts)
+	addFilterFlags(flags, &opts.searchFilters)
+}
+
+// addOutputFlags registers the machine-readable output flags.
+func addOutputFlags(flags *pflag.FlagSet, opts *outputOpts) {
+	flags.StringVarP(&opts.Output, "output", "o", "", "Print results for scripts as json, ndjson, tsv or paths, without prompting")
+	flags.BoolVarP(&opts.NullSeparated, "null", "0", false, "Separate paths with NUL characters, for xargs -0 (implies --output paths)")
+}
+
+// addFilterFlags registers the metadata filter flags.
+func addFilterFlags(flags *pflag.FlagSet, opts *searchFilters) {
+	flags.StringSliceVar(&opts.Dirs, "dir", []string{}, "Only search files under these directories")
+	flags.StringSliceVar(&opts.Exts, "ext", []string{}, "Only search files with these extensions")
+	flags.StringSliceVar(&opts.Types, "type", []string{}, "Only search files of these types (image, pdf, text, video, other)")
+	flags.StringVar(&opts.MinSize, "min-size", "", "Only search files at least this large (e.g. 500KB, 1.5MB)")
+	flags.StringVar(&opts.MaxSize, "max-size", "", "Only search files at most this large (e.g. 10MB)")
+	flags.StringVar(&opts.ModifiedAfter, "modified-after", "", "Only search files modified on or after this date (YYYY, YYYY-MM or YYYY-MM-DD)")
+	flags.StringVar(&opts.ModifiedBefore, "modified-before", "", "Only search files modified before this date (YYYY, YYYY-MM or YYYY-MM-DD)")
+}
+
 func NewChatCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "chat",
@@ -114,6 +341,7 @@ Functionalities:
 	- Set Style            : "$style <style_name>" (Sets the output style.)
 	- Index Files          : "$index"              (Indexes files in the specified directory for search purposes)
 	- Search Files         : "$search <query>"     (Searches indexed files based on the provided query)
+	                                               (Accepts the search command's flags, e.g. "$search --dir ~/work --ext xlsx budget")
  
 Different styles include:
 	- AsciiStyle           : "ascii"               (ASCII-art inspired style)
@@ -5,20 +5,90 @@ import (
 	"errors"
 	"fmt"
 	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
 	"os"
 	"os/exec"
 	"path/filepath"
 )
 
 type ConfigData struct {
-	Directories    []string `json:"directories"`
-	SkipType       []string `json:"skip_types"`
-	SkipFile       []string `json:"skip_files"`
-	RelevanceIndex float32  `json:"relevance_index"`
+	Directories []string `json:"directories"`
+	SkipType    []string `json:"skip_types"`
+	SkipFile    []string `json:"skip_files"`
+
+	// RelevanceIndex is the setting from before scores were calibrated. Its
+	// flag defaulted to legacyRelevanceIndex and nothing read it, so nearly
+	// every config holds that value. Search ignores it; the next 'gencli
+	// config' drops it, moving any other value to RelevanceThreshold.
+	RelevanceIndex     float32 `json:"relevance_index,omitempty"`
+	RelevanceThreshold float32 `json:"relevance_threshold,omitempty"`
+
 	APIKeys        []string `json:"api_keys"`
+	EmbeddingModel string   `json:"embedding_model,omitempty"`
+
+	Actions ResultActions `json:"actions,omitempty"`
+}
+
+// ResultActions configures what happens to a search result when it is
+// opened, revealed, edited or passed to a user-defined command. Commands are
+// templates split like a shell command line, in which {path}, {dir}, {name},
+// {id}, {line} and {page} are replaced; the path is appended when none of
+// them appears. Empty fields use the system defaults.
+type ResultActions struct {
+	Open     string          `json:"open,omitempty"`   // instead of the default application
+	Reveal   string          `json:"reveal,omitempty"` // instead of the system file manager
+	Editor   string          `json:"editor,omitempty"` // instead of $VISUAL or $EDITOR
+	Commands []CommandAction `json:"commands,omitempty"`
 }
 
-func setConfig(addDirectories, deleteDirectories, addSkipTypes, deleteSkipTypes, addSkipFiles, deleteSkipFiles, addAPIKeys, deleteAPIKeys []string, relevanceIndex float32) error {
+// CommandAction is a named command template run on a result in the
+// terminal. Key, if set, runs it from the result browser.
+type CommandAction struct {
+	Name    string `json:"name"`
+	Key     string `json:"key,omitempty"`
+	Command string `json:"command"`
+}
+
+// relevanceThreshold returns the configured minimum relevance for search
+// results, or the default one.
+func (c *ConfigData) relevanceThreshold() float32 {
+	if c.RelevanceThreshold <= 0 {
+		return gemini.DefaultRelevanceThreshold
+	}
+	return c.RelevanceThreshold
+}
+
+// embeddingModel returns the configured embedding model, or the default one.
+// legacyRelevanceIndex is the value every 'gencli config' wrote to
+// relevance_index before scores were calibrated.
+const legacyRelevanceIndex = 0.8
+
+// migrateRelevanceIndex drops the old relevance_index setting. A value the
+// user chose, taken as a raw similarity cut-off, becomes the relevance
+// threshold unless one is set already.
+func (c *ConfigData) migrateRelevanceIndex() {
+	old := c.RelevanceIndex
+	c.RelevanceIndex = 0
+	if old == 0 || old == legacyRelevanceIndex {
+		return
+	}
+
+	if c.RelevanceThreshold > 0 {
+		fmt.Println(fileinfo.Yellow(fmt.Sprintf("Dropped the old relevance_index %.2f; the relevance threshold %.2f is used instead", old, c.RelevanceThreshold)))
+		return
+	}
+	c.RelevanceThreshold = gemini.Relevance(c.embeddingModel(), old)
+	fmt.Println(fileinfo.Yellow(fmt.Sprintf("Moved the old relevance_index %.2f to a relevance threshold of %.2f for %s", old, c.RelevanceThreshold, c.embeddingModel())))
+}
+
+func (c *ConfigData) embeddingModel() string {
+	if c.EmbeddingModel == "" {
+		return gemini.DefaultEmbeddingModel
+	}
+	return c.EmbeddingModel
+}
+
+func setConfig(addDirectories, deleteDirectories, addSkipTypes, deleteSkipTypes, addSkipFiles, deleteSkipFiles, addAPIKeys, deleteAPIKeys []string, relevanceIndex float32, embeddingModel string) error {
 
 	config, err := LoadConfig()
 	if err != nil {
@@ -75,8 +145,14 @@ func setConfig(addDirectories, deleteDirectories, addSkipTypes, deleteSkipTypes,
 		config.APIKeys = removeElements(config.APIKeys, api)
 	}
 
+	config.migrateRelevanceIndex()
 	if relevanceIndex > 0 {
-		config.RelevanceIndex = relevanceIndex
+		config.RelevanceThreshold = relevanceIndex
+	}
+
+	if embeddingModel != "" && embeddingModel != config.EmbeddingModel {
+		config.EmbeddingModel = embeddingModel
+		fmt.Println(fileinfo.Yellow("Embedding model changed. Run 'gencli index --reembed' to regenerate existing embeddings."))
 	}
 
 	if err := SaveConfig(config); err != nil {
@@ -123,22 +199,9 @@ func EditConfig() error {
 
 	fmt.Printf("Config file path: %s\n", configPath)
 
-	// Try to determine the default editor
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		// Try common editors if EDITOR environment variable is not set
-		possibleEditors := []string{"nano", "vim", "vi", "notepad", "code", "gedit"}
-		for _, e := range possibleEditors {
-			path, err := exec.LookPath(e)
-			if err == nil {
-				editor = path
-				break
-			}
-		}
-		
-		if editor == "" {
-			return fmt.Errorf("no editor found, please set the EDITOR environment variable")
-		}
+	editor, err := findEditor()
+	if err != nil {
+		return err
 	}
 
 	// Prepare the command to open the file with the editor
@@ -186,15 +249,12 @@ func SaveConfig(config *ConfigData) error {
 		return err
 	}
 
-	configPath := filepath.Join(configDir, ".gencli-config.json")
-	file, err := os.Create(configPath)
+	data, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	return encoder.Encode(config)
+	return fileinfo.WriteFileAtomic(filepath.Join(configDir, ".gencli-config.json"), append(data, '\n'), 0644)
 }
 
 func showConfigFormatted(config *ConfigData) {
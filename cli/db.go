@@ -1,11 +1,13 @@
 package cli
 
 import (
-	"encoding/json"
+	"fmt"
 	"gemini_cli_tool/fileinfo"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 func GetConfigDir() (string, error) {
@@ -34,44 +36,87 @@ func GetConfigDir() (string, error) {
 	return configDir, nil
 }
 
+// LoadIndex reads every indexed file from the index database.
 func LoadIndex() ([]fileinfo.FileInfo, error) {
-
-	configDir, err := GetConfigDir()
+	store, err := fileinfo.OpenStore()
 	if err != nil {
 		return nil, err
 	}
+	defer store.Close()
 
-	var files []fileinfo.FileInfo
-
-	indexPath := filepath.Join(configDir, ".gencli-index.json")
-	data, err := os.ReadFile(indexPath)
+	files, err := store.Files()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, it's not an error; it just means no hashes were saved yet.
-			return files, nil
-		}
 		return nil, err
 	}
 
-	if err := json.Unmarshal(data, &files); err != nil {
-		return nil, err
+	// Indexes written by older versions hold raw embeddings; search compares
+	// unit vectors only. Already normalised vectors are left untouched.
+	for i := range files {
+		files[i].NormalizeEmbeddings()
 	}
 
 	return files, nil
 }
 
-func StoreIndex(files []fileinfo.FileInfo) error {
+// LoadIndexMetadata reads every indexed file without its embedding and
+// chunks, which is enough to filter files; loadEmbeddings reads them for the
+// files that need them.
+func LoadIndexMetadata() ([]fileinfo.FileInfo, error) {
+	store, err := fileinfo.OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return store.FileMetadata()
+}
 
-	configDir, err := GetConfigDir()
+// loadEmbeddings reads the embeddings and chunks of files loaded by
+// LoadIndexMetadata, normalised as LoadIndex does.
+func loadEmbeddings(files []*fileinfo.FileInfo) error {
+	store, err := fileinfo.OpenStore()
 	if err != nil {
 		return err
 	}
+	defer store.Close()
+
+	if err := store.LoadEmbeddings(files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		file.NormalizeEmbeddings()
+	}
+	return nil
+}
 
-	indexPath := filepath.Join(configDir, ".gencli-index.json")
-	jsonData, err := json.MarshalIndent(files, "", "  ")
+// UpdateIndex writes only what changed: files are added or replaced, and the
+// files at the paths in deleted are removed.
+func UpdateIndex(files []fileinfo.FileInfo, deleted []string) error {
+	store, err := fileinfo.OpenStore()
 	if err != nil {
 		return err
 	}
+	defer store.Close()
 
-	return os.WriteFile(indexPath, jsonData, 0644)
+	return store.Update(files, deleted)
+}
+
+// resolveFileRef returns the path named by ref: a path, or "#" followed by
+// the ID of a file in files.
+func resolveFileRef(ref string, files []fileinfo.FileInfo) (string, error) {
+	idText, isID := strings.CutPrefix(ref, "#")
+	if !isID {
+		return fileinfo.ExpandDir(ref)
+	}
+
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return "", fmt.Errorf("invalid file ID %q", ref)
+	}
+	for _, file := range files {
+		if file.Id == id {
+			return filepath.Abs(filepath.Join(file.Directory, file.Name))
+		}
+	}
+	return "", fmt.Errorf("no indexed file has ID %d", id)
 }
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDupeSimilarity = 0.97
+	defaultDupeOverlap    = 0.8
+)
+
+type dupesOpts struct {
+	ExactOnly     bool
+	MinSimilarity float32
+	MinOverlap    float64
+	Quantized     bool
+	JSONPath      string
+}
+
+// dupesReport is the JSON export of a duplicate scan.
+type dupesReport struct {
+	GeneratedAt      time.Time                   `json:"generatedAt"`
+	Clusters         []fileinfo.DuplicateCluster `json:"clusters"`
+	TotalReclaimable int64                       `json:"totalReclaimable"`
+}
+
+func dupesCmd(opts *dupesOpts) error {
+	report, err := findDuplicates(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.JSONPath != "" {
+		return writeDupesReport(report, opts.JSONPath)
+	}
+
+	if len(report.Clusters) == 0 {
+		fmt.Println(fileinfo.Green("\nNo duplicates found"))
+		return nil
+	}
+
+	fmt.Print(formatDuplicateClusters(report.Clusters))
+	fmt.Println(fileinfo.Green(fmt.Sprintf("%d clusters, %s reclaimable", len(report.Clusters), fileinfo.FormatSize(report.TotalReclaimable))))
+	return nil
+}
+
+// findDuplicates scans the index for exact duplicates and, unless
+// opts.ExactOnly is set, near duplicates. Near-duplicate clusters that only
+// repeat an exact cluster are dropped.
+func findDuplicates(opts *dupesOpts) (*dupesReport, error) {
+	if opts.MinSimilarity > 1 || opts.MinOverlap > 1 {
+		return nil, fmt.Errorf("--min-similarity and --min-overlap must be between 0 and 1")
+	}
+
+	files, err := LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index : %w", err)
+	}
+
+	clusters := fileinfo.FindExactDuplicates(files)
+
+	if !opts.ExactOnly {
+		exactCluster := make(map[string]int)
+		for i, cluster := range clusters {
+			for _, file := range cluster.Files {
+				exactCluster[file.Path] = i
+			}
+		}
+
+		near := fileinfo.FindNearDuplicates(files, fileinfo.DuplicateOptions{MinSimilarity: opts.MinSimilarity, MinOverlap: opts.MinOverlap, Quantized: opts.Quantized})
+		for _, cluster := range near {
+			if !withinOneCluster(cluster, exactCluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+
+	// A near cluster can contain files of an exact one, so sizes are not summed per cluster
+	return &dupesReport{GeneratedAt: time.Now(), Clusters: clusters, TotalReclaimable: fileinfo.TotalReclaimable(clusters)}, nil
+}
+
+func withinOneCluster(cluster fileinfo.DuplicateCluster, exactCluster map[string]int) bool {
+	first, ok := exactCluster[cluster.Files[0].Path]
+	if !ok {
+		return false
+	}
+	for _, file := range cluster.Files[1:] {
+		if i, ok := exactCluster[file.Path]; !ok || i != first {
+			return false
+		}
+	}
+	return true
+}
+
+// writeDupesReport writes the report as JSON to path, or to stdout for "-".
+func writeDupesReport(report *dupesReport, path string) error {
+	if path == "-" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fileinfo.WriteFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report : %w", err)
+	}
+
+	fmt.Println(fileinfo.Green(fmt.Sprintf("Wrote %d clusters to %s", len(report.Clusters), path)))
+	return nil
+}
+
+// formatDuplicateClusters lists each cluster with its files, marking the one
+// assumed to be kept.
+func formatDuplicateClusters(clusters []fileinfo.DuplicateCluster) string {
+	var builder strings.Builder
+	for i, cluster := range clusters {
+		heading := "exact duplicates"
+		if cluster.Kind == fileinfo.DuplicateNear {
+			heading = fmt.Sprintf("near duplicates, similarity %.2f", cluster.Similarity)
+		}
+
+		builder.WriteString(fmt.Sprintf("\n%s %s %s\n", fileinfo.Cyan(fmt.Sprintf("[%d]", i+1)), heading,
+			fileinfo.Gray(fmt.Sprintf("(%d files, %s, %s reclaimable)", len(cluster.Files), fileinfo.FormatSize(cluster.TotalSize), fileinfo.FormatSize(cluster.Reclaimable)))))
+
+		for _, file := range cluster.Files {
+			marker := "   "
+			if file.Keep {
+				marker = fileinfo.Green(" * ")
+			}
+			builder.WriteString(fmt.Sprintf("  %s%s %s\n", marker, file.Path,
+				fileinfo.Gray(fmt.Sprintf("(%s, %s)", fileinfo.FormatSize(file.Size), file.ModifiedTime.Format("2006-01-02 15:04")))))
+		}
+	}
+	builder.WriteString(fmt.Sprintf("\n%s\n", fileinfo.Gray("* most recently modified, assumed kept")))
+	return builder.String()
+}
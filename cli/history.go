@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxHistoryEntries = 500 // oldest entries are dropped beyond this
+	historyListLength = 20  // entries shown by --history
+	historyResults    = 10  // result paths kept per entry
+)
+
+// historyEntry is a search as it was run, from the command line or chat.
+type historyEntry struct {
+	Time    time.Time     `json:"time"`
+	Query   string        `json:"query"`
+	Filters searchFilters `json:"filters"`
+	Results []string      `json:"results,omitempty"`
+}
+
+// savedSearch is a named query with its filters. LastResults are the paths
+// returned by its previous run, so the next run can tell what is new.
+type savedSearch struct {
+	Query       string        `json:"query"`
+	Filters     searchFilters `json:"filters"`
+	Created     time.Time     `json:"created"`
+	LastRun     time.Time     `json:"lastRun"`
+	LastResults []string      `json:"lastResults,omitempty"`
+}
+
+// recordSearch appends a search to the history. Failing to record it only
+// warns, since the search itself succeeded.
+func recordSearch(query string, filters searchFilters, hits []searchHit) {
+	entry := historyEntry{Time: time.Now(), Query: query, Filters: filters}
+	for _, hit := range hits[:min(len(hits), historyResults)] {
+		entry.Results = append(entry.Results, hitPath(hit))
+	}
+
+	history, err := loadSearchHistory()
+	if err == nil {
+		history = append(history, entry)
+		if len(history) > maxHistoryEntries {
+			history = history[len(history)-maxHistoryEntries:]
+		}
+		err = saveSearchHistory(history)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(fmt.Sprintf("Could not save search history : %v", err)))
+	}
+}
+
+// searchHistoryCmd lists the most recent searches and offers to run one of
+// them again with its filters.
+func searchHistoryCmd(opts *searchOpts) error {
+	history, err := loadSearchHistory()
+	if err != nil {
+		return fmt.Errorf("failed to load search history : %w", err)
+	}
+	if len(history) == 0 {
+		fmt.Println(fileinfo.Yellow("\nNo searches recorded yet"))
+		return nil
+	}
+
+	// Newest first
+	recent := make([]historyEntry, 0, historyListLength)
+	for i := len(history) - 1; i >= 0 && len(recent) < historyListLength; i-- {
+		recent = append(recent, history[i])
+	}
+
+	fmt.Printf("\n%s\n\n", fileinfo.Green("Recent searches -"))
+	for i, entry := range recent {
+		fmt.Printf("%s %s %s%s %s\n", fileinfo.Cyan(fmt.Sprintf("[%d]", i+1)), fileinfo.Gray(entry.Time.Format("2006-01-02 15:04")), entry.Query, formatFilters(entry.Filters), fileinfo.Gray(fmt.Sprintf("(%d results)", len(entry.Results))))
+	}
+	if opts.NonInteractive || opts.Output != "" {
+		return nil
+	}
+
+	fmt.Print(fileinfo.Blue(fmt.Sprintf("\nEnter a number (1-%d) to run that search again, or any other key to cancel: ", len(recent))))
+
+	response := readResponse()
+
+	choice, err := strconv.Atoi(strings.TrimSpace(response))
+	if err != nil || choice < 1 || choice > len(recent) {
+		return nil
+	}
+
+	entry := recent[choice-1]
+	opts.searchFilters = entry.Filters
+	return runSearch(entry.Query, opts, "")
+}
+
+// saveSearchCmd stores query and its filters under name, replacing any
+// saved search of that name.
+func saveSearchCmd(name, query string, filters searchFilters) error {
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return fmt.Errorf("failed to load saved searches : %w", err)
+	}
+
+	// Parse now, so a broken query is reported when saving rather than running
+	if _, err := fileinfo.ParseQuery(query); err != nil {
+		return fmt.Errorf("invalid query : %w", err)
+	}
+	if _, err := (&searchOpts{searchFilters: filters}).filter(); err != nil {
+		return err
+	}
+
+	_, replaced := saved[name]
+	saved[name] = &savedSearch{Query: query, Filters: filters, Created: time.Now()}
+	if err := saveSavedSearches(saved); err != nil {
+		return fmt.Errorf("failed to save search : %w", err)
+	}
+
+	if replaced {
+		fmt.Println(fileinfo.Green(fmt.Sprintf("Replaced saved search %q", name)))
+	} else {
+		fmt.Println(fileinfo.Green(fmt.Sprintf("Saved search %q; run it with 'gencli searches run %s'", name, name)))
+	}
+	return nil
+}
+
+// runSavedSearchCmd runs a saved search. Filters given on the command line
+// are combined with the saved ones.
+func runSavedSearchCmd(name string, opts *searchOpts) error {
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return fmt.Errorf("failed to load saved searches : %w", err)
+	}
+	search, ok := saved[name]
+	if !ok {
+		return fmt.Errorf("no saved search named %q; see 'gencli searches list'", name)
+	}
+
+	opts.searchFilters.merge(search.Filters)
+	return runSearch(search.Query, opts, name)
+}
+
+// savedSearchAlias reports whether the arguments of search spell out
+// 'search save <name> <query>' or 'search run <name>', returning "save" or
+// "run", or "" for an ordinary query. run only applies when a search of that
+// name is saved, and neither applies to words after "--", so
+// 'gencli search -- save money' always searches.
+func savedSearchAlias(args []string, dashAt int) string {
+	if len(args) < 2 || dashAt == 0 {
+		return ""
+	}
+
+	switch args[0] {
+	case "save":
+		if len(args) >= 3 && (dashAt < 0 || dashAt > 1) {
+			return "save"
+		}
+	case "run":
+		if len(args) != 2 || dashAt == 1 {
+			return ""
+		}
+		if saved, err := loadSavedSearches(); err == nil && saved[args[1]] != nil {
+			return "run"
+		}
+	}
+	return ""
+}
+
+// savedSearchesCmd lists the saved searches, or deletes one.
+func savedSearchesCmd(deleteName string) error {
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return fmt.Errorf("failed to load saved searches : %w", err)
+	}
+
+	if deleteName != "" {
+		if _, ok := saved[deleteName]; !ok {
+			return fmt.Errorf("no saved search named %q", deleteName)
+		}
+		delete(saved, deleteName)
+		if err := saveSavedSearches(saved); err != nil {
+			return fmt.Errorf("failed to save searches : %w", err)
+		}
+		fmt.Println(fileinfo.Green(fmt.Sprintf("Deleted saved search %q", deleteName)))
+		return nil
+	}
+
+	if len(saved) == 0 {
+		fmt.Println(fileinfo.Yellow("\nNo saved searches. Save one with 'gencli searches save <name> <query>'"))
+		return nil
+	}
+
+	names := make([]string, 0, len(saved))
+	for name := range saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	for _, name := range names {
+		search := saved[name]
+		lastRun := "never run"
+		if !search.LastRun.IsZero() {
+			lastRun = "last run " + search.LastRun.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s %s%s %s\n", fileinfo.Cyan(name), search.Query, formatFilters(search.Filters), fileinfo.Gray("("+lastRun+")"))
+	}
+	return nil
+}
+
+// markNewHits flags the hits the saved search did not return last time and
+// records this run. It returns the time of the previous run, zero on the
+// first run, when nothing is marked.
+func markNewHits(name string, hits []searchHit) time.Time {
+	saved, err := loadSavedSearches()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(fmt.Sprintf("Could not load saved searches : %v", err)))
+		return time.Time{}
+	}
+	search, ok := saved[name]
+	if !ok {
+		return time.Time{}
+	}
+
+	lastRun := search.LastRun
+	if !lastRun.IsZero() {
+		for i := range hits {
+			hits[i].New = !contains(search.LastResults, hitPath(hits[i]))
+		}
+	}
+
+	search.LastRun = time.Now()
+	search.LastResults = nil
+	for _, hit := range hits {
+		search.LastResults = append(search.LastResults, hitPath(hit))
+	}
+	if err := saveSavedSearches(saved); err != nil {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(fmt.Sprintf("Could not save search run : %v", err)))
+	}
+
+	return lastRun
+}
+
+func countNewHits(hits []searchHit) int {
+	count := 0
+	for _, hit := range hits {
+		if hit.New {
+			count++
+		}
+	}
+	return count
+}
+
+// merge adds other's filters to f. Size and date bounds already set in f
+// take precedence.
+func (f *searchFilters) merge(other searchFilters) {
+	f.Dirs = append(f.Dirs, other.Dirs...)
+	f.Exts = append(f.Exts, other.Exts...)
+	f.Types = append(f.Types, other.Types...)
+	if f.MinSize == "" {
+		f.MinSize = other.MinSize
+	}
+	if f.MaxSize == "" {
+		f.MaxSize = other.MaxSize
+	}
+	if f.ModifiedAfter == "" {
+		f.ModifiedAfter = other.ModifiedAfter
+	}
+	if f.ModifiedBefore == "" {
+		f.ModifiedBefore = other.ModifiedBefore
+	}
+}
+
+// formatFilters renders filters as the flags that set them, with a leading
+// space, or "" when there are none.
+func formatFilters(f searchFilters) string {
+	var flags []string
+	for _, dir := range f.Dirs {
+		flags = append(flags, "--dir "+dir)
+	}
+	for _, ext := range f.Exts {
+		flags = append(flags, "--ext "+ext)
+	}
+	for _, t := range f.Types {
+		flags = append(flags, "--type "+t)
+	}
+	for _, bound := range [][2]string{{"--min-size", f.MinSize}, {"--max-size", f.MaxSize}, {"--modified-after", f.ModifiedAfter}, {"--modified-before", f.ModifiedBefore}} {
+		if bound[1] != "" {
+			flags = append(flags, bound[0]+" "+bound[1])
+		}
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+
+	return " " + fileinfo.Gray(strings.Join(flags, " "))
+}
+
+func loadSearchHistory() ([]historyEntry, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var history []historyEntry
+
+	data, err := os.ReadFile(filepath.Join(configDir, ".gencli-search-history.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func saveSearchHistory(history []historyEntry) error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileinfo.WriteFileAtomic(filepath.Join(configDir, ".gencli-search-history.json"), jsonData, 0644)
+}
+
+func loadSavedSearches() (map[string]*savedSearch, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	saved := make(map[string]*savedSearch)
+
+	data, err := os.ReadFile(filepath.Join(configDir, ".gencli-saved-searches.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return saved, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func saveSavedSearches(saved map[string]*savedSearch) error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileinfo.WriteFileAtomic(filepath.Join(configDir, ".gencli-saved-searches.json"), jsonData, 0644)
+}
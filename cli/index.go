@@ -12,8 +12,13 @@ import (
 // var writer = bufio.NewWriter(os.Stdout)
 // var spinners = newSpinner(5, time.Second, writer)
 
-func indexFilesCmd(hs *fileinfo.HashSet) error {
-	err := indexFiles(hs)
+type indexOpts struct {
+	RetryMetadata bool
+	Reembed       bool
+}
+
+func indexFilesCmd(hs *fileinfo.HashSet, opts *indexOpts) error {
+	err := indexFiles(hs, opts)
 
 	// spinners.stop()
 
@@ -24,7 +29,7 @@ func indexFilesCmd(hs *fileinfo.HashSet) error {
 	return err
 }
 
-func indexFiles(hs *fileinfo.HashSet) error {
+func indexFiles(hs *fileinfo.HashSet, opts *indexOpts) error {
 
 	// spinners.start()
 
@@ -39,6 +44,17 @@ func indexFiles(hs *fileinfo.HashSet) error {
 	}
 	defaultApiKey := apiKeys[0]
 
+	lock, err := fileinfo.LockConfigDir("indexing")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Another process may have indexed since the hash set was loaded
+	if err := hs.Load(); err != nil {
+		return fmt.Errorf("failed to load hash set : %w", err)
+	}
+
 	indexedFiles, err := LoadIndex()
 	if err != nil {
 		return err
@@ -48,7 +64,6 @@ func indexFiles(hs *fileinfo.HashSet) error {
 	var newFiles = []fileinfo.FileInfo{}
 	var finalFiles = []fileinfo.FileInfo{}
 
-	i := 0
 	for _, dir := range config.Directories {
 		// fmt.Printf("Checking directory: %s\n", dir)
 
@@ -72,7 +87,6 @@ func indexFiles(hs *fileinfo.HashSet) error {
 
 			if !info.IsDir() && !shouldSkip(info.Name(), config.SkipType, config.SkipFile) {
 				file := fileinfo.FileInfo{
-					Id:           i,
 					Name:         info.Name(),
 					Directory:    filepath.Dir(path),
 					Size:         info.Size(),
@@ -81,7 +95,6 @@ func indexFiles(hs *fileinfo.HashSet) error {
 				}
 
 				toIndexFiles = append(toIndexFiles, file)
-				i++
 			}
 			return nil
 		})
@@ -116,11 +129,25 @@ func indexFiles(hs *fileinfo.HashSet) error {
 	// 	fmt.Printf("\nDescription : %s \n", file.Description)
 	// }
 
+	var retryFiles = []fileinfo.FileInfo{}
+	var backfilled = []fileinfo.FileInfo{}
+
 	// Identify deleted files
 	for _, file := range toIndexFiles {
 		fileHash := fileinfo.GenerateFileHash(file)
-		if _, exists := existingFiles[fileHash]; exists {
-			finalFiles = append(finalFiles, existingFiles[fileHash])
+		if existing, exists := existingFiles[fileHash]; exists {
+			// Files indexed before content hashes were recorded get them, once,
+			// so they can be recognised if they move
+			if existing.PartialHash == "" || existing.ContentHash == "" {
+				if backfillHashes(&existing) {
+					backfilled = append(backfilled, existing)
+				}
+			}
+			if opts.RetryMetadata && !existing.HasDescription() {
+				retryFiles = append(retryFiles, existing)
+				continue
+			}
+			finalFiles = append(finalFiles, existing)
 		} else {
 			hs.Remove(fileHash)
 		}
@@ -140,9 +167,64 @@ func indexFiles(hs *fileinfo.HashSet) error {
 		// }
 	}
 
+	// Indexed files no longer found with the same path, size and time
+	seen := make(map[string]bool, len(toIndexFiles))
+	for _, file := range toIndexFiles {
+		seen[fileinfo.GenerateFileHash(file)] = true
+	}
+	var disappeared []fileinfo.FileInfo
+	for _, file := range indexedFiles {
+		if fileHash := fileinfo.GenerateFileHash(file); !seen[fileHash] {
+			disappeared = append(disappeared, file)
+			// So the file is indexed again if it comes back
+			hs.Remove(fileHash)
+		}
+	}
+
+	// Renamed and moved files keep their description and embeddings
+	newFiles, moves := matchMovedFiles(newFiles, indexedFiles, disappeared)
+	for _, move := range moves {
+		finalFiles = append(finalFiles, move.file)
+	}
+	added := len(newFiles)
+
+	// Previously blocked or empty files are described again
+	newFiles = append(newFiles, retryFiles...)
+
+	embeddingModel := config.embeddingModel()
+
 	//Generate descriptions using Gemini
-	newFiles = gemini.GenerateDescriptions(newFiles, apiKeys, hs)
-	newFiles = gemini.GenerateEmbeddings(newFiles, defaultApiKey)
+	newFiles = gemini.GenerateDescriptions(newFiles, apiKeys, hs, opts.RetryMetadata)
+	newFiles = gemini.GenerateEmbeddings(newFiles, defaultApiKey, embeddingModel)
+
+	// Embeddings from another model are regenerated from the stored descriptions
+	var currentFiles, staleFiles []fileinfo.FileInfo
+	for _, file := range finalFiles {
+		if file.HasDescription() && file.EmbeddedWith() != embeddingModel {
+			staleFiles = append(staleFiles, file)
+		} else {
+			currentFiles = append(currentFiles, file)
+		}
+	}
+
+	// Only new, moved, re-described, re-embedded and newly hashed files are
+	// written to the index. Hashed files go first, so later copies win.
+	changedFiles := backfilled
+	for _, move := range moves {
+		changedFiles = append(changedFiles, move.file)
+	}
+	changedFiles = append(changedFiles, newFiles...)
+
+	if len(staleFiles) > 0 {
+		if opts.Reembed {
+			fmt.Printf("Re-embedding %d files with %s\n", len(staleFiles), embeddingModel)
+			reembedded := gemini.GenerateEmbeddings(staleFiles, defaultApiKey, embeddingModel)
+			finalFiles = append(currentFiles, reembedded...)
+			changedFiles = append(changedFiles, reembedded...)
+		} else {
+			fmt.Println(fileinfo.Yellow(fmt.Sprintf("%d indexed files were embedded with a different model than %s. Run 'gencli index --reembed' to update them.", len(staleFiles), embeddingModel)))
+		}
+	}
 
 	finalFiles = append(finalFiles, newFiles...)
 
@@ -154,13 +236,258 @@ func indexFiles(hs *fileinfo.HashSet) error {
 	// 	fmt.Printf("\nDescription : %s \n", file.Description)
 	// }
 
-	if err := StoreIndex(finalFiles); err != nil {
+	kept := make(map[string]bool, len(finalFiles))
+	for _, file := range finalFiles {
+		kept[filepath.Join(file.Directory, file.Name)] = true
+	}
+	var deletedPaths []string
+	for _, file := range indexedFiles {
+		if path := filepath.Join(file.Directory, file.Name); !kept[path] {
+			deletedPaths = append(deletedPaths, path)
+		}
+	}
+
+	if err := UpdateIndex(changedFiles, deletedPaths); err != nil {
 		return fmt.Errorf("failed to store index : %w", err)
 	}
+	printIndexSummary(added, moves, len(deletedPaths)-len(moves))
+	// Saved while the lock is held, rather than by main once the command ends
+	if err := hs.Save(); err != nil {
+		return fmt.Errorf("failed to store hash set : %w", err)
+	}
+
+	// New files only have IDs once stored, and the vector index is keyed by them
+	finalFiles, err = LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index : %w", err)
+	}
+
+	if err := fileinfo.BuildKeywordIndex(finalFiles).SaveToFile(); err != nil {
+		return fmt.Errorf("failed to store keyword index : %w", err)
+	}
+
+	graph, err := fileinfo.LoadVectorIndex()
+	if err != nil {
+		fmt.Println(fileinfo.Yellow(fmt.Sprintf("Rebuilding vector index : %v", err)))
+	}
+	if err := graph.Sync(finalFiles, embeddingModel).SaveToFile(); err != nil {
+		return fmt.Errorf("failed to store vector index : %w", err)
+	}
+
+	return nil
+}
+
+// renamedFile is an indexed file found at a new path, with its index entry
+// carried over.
+type renamedFile struct {
+	from string
+	file fileinfo.FileInfo
+}
+
+// matchMovedFiles compares the new files with the indexed files that
+// disappeared. A new file at an indexed file's path was changed in place and
+// keeps its ID only. Size and partial hash only pick candidates: a new file
+// was renamed or moved if its full hash equals the one recorded for a
+// disappeared file, and then it takes over the old entry, with its
+// description, embeddings and ID, and is returned as a move rather than among
+// the files still to be described. Full hashes are computed for candidates
+// first and then for the files that stay new, since a later move can only be
+// confirmed against a recorded one.
+func matchMovedFiles(newFiles, indexedFiles, disappeared []fileinfo.FileInfo) ([]fileinfo.FileInfo, []renamedFile) {
+	ids := make(map[string]int, len(indexedFiles))
+	for _, file := range indexedFiles {
+		ids[filepath.Join(file.Directory, file.Name)] = file.Id
+	}
+
+	byPath := make(map[string]int, len(disappeared))
+	bySize := make(map[int64][]int)
+	for i, file := range disappeared {
+		byPath[filepath.Join(file.Directory, file.Name)] = i
+		// Empty files all look alike, and without a full hash a move cannot be confirmed
+		if file.Size > 0 && file.ContentHash != "" {
+			bySize[file.Size] = append(bySize[file.Size], i)
+		}
+	}
+
+	claimed := make(map[int]bool)
+	var unmatched []int
+	for i := range newFiles {
+		file := &newFiles[i]
+		path := filepath.Join(file.Directory, file.Name)
+		if id, ok := ids[path]; ok {
+			file.Id = id
+			if j, ok := byPath[path]; ok {
+				claimed[j] = true
+			}
+		} else if len(bySize[file.Size]) > 0 {
+			file.PartialHash, _ = fileinfo.PartialContentHash(path)
+			unmatched = append(unmatched, i)
+		}
+	}
+
+	// Matched by content only once every file changed in place has its own entry
+	var moves []renamedFile
+	moved := make(map[int]bool)
+	for _, i := range unmatched {
+		file := &newFiles[i]
+		if file.PartialHash == "" {
+			continue
+		}
+		for _, j := range bySize[file.Size] {
+			old := disappeared[j]
+			if claimed[j] || old.PartialHash != file.PartialHash {
+				continue
+			}
+			if file.ContentHash == "" {
+				file.ContentHash, _ = fileinfo.ContentHash(filepath.Join(file.Directory, file.Name))
+			}
+			if file.ContentHash == "" || old.ContentHash != file.ContentHash {
+				continue
+			}
+
+			claimed[j] = true
+			moved[i] = true
+			from := filepath.Join(old.Directory, old.Name)
+			old.Name, old.Directory, old.ModifiedTime = file.Name, file.Directory, file.ModifiedTime
+			moves = append(moves, renamedFile{from: from, file: old})
+			break
+		}
+	}
+
+	remaining := newFiles[:0:0]
+	for i, file := range newFiles {
+		if !moved[i] {
+			backfillHashes(&file)
+			remaining = append(remaining, file)
+		}
+	}
+	return remaining, moves
+}
+
+// backfillHashes records the partial and full content hashes a file is
+// missing, reporting whether any was added.
+func backfillHashes(file *fileinfo.FileInfo) bool {
+	path := filepath.Join(file.Directory, file.Name)
+	added := false
+	if file.PartialHash == "" {
+		if hash, err := fileinfo.PartialContentHash(path); err == nil {
+			file.PartialHash = hash
+			added = true
+		}
+	}
+	if file.ContentHash == "" {
+		if hash, err := fileinfo.ContentHash(path); err == nil {
+			file.ContentHash = hash
+			added = true
+		}
+	}
+	return added
+}
+
+// printIndexSummary reports what the run changed, listing renamed and moved
+// files separately from new and removed ones.
+func printIndexSummary(added int, moves []renamedFile, removed int) {
+	fmt.Printf("\n%s %d\n%s %d\n%s %d\n", fileinfo.Yellow("New or changed files :"), added, fileinfo.Yellow("Renamed or moved :"), len(moves), fileinfo.Yellow("Removed :"), removed)
+	for _, move := range moves {
+		fmt.Printf("  %s %s %s\n", fileinfo.Gray(move.from), fileinfo.Gray("->"), filepath.Join(move.file.Directory, move.file.Name))
+	}
+}
+
+// indexStatusCmd lists the indexed files that have no usable description,
+// along with files described from metadata only, and the reason for each.
+func indexStatusCmd() error {
+	files, err := LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index : %w", err)
+	}
+
+	var undescribed, metadataOnly []fileinfo.FileInfo
+	for _, file := range files {
+		if file.Status == fileinfo.StatusMetadataOnly {
+			metadataOnly = append(metadataOnly, file)
+		} else if !file.HasDescription() {
+			undescribed = append(undescribed, file)
+		}
+	}
+
+	fmt.Printf("\n%s %d\n%s %d\n%s %d\n", fileinfo.Yellow("Indexed files :"), len(files), fileinfo.Yellow("Without description :"), len(undescribed), fileinfo.Yellow("Described from metadata only :"), len(metadataOnly))
+
+	// Embedding model and dimension, so a model change shows up before search misbehaves
+	embeddings := make(map[string]int)
+	for _, file := range files {
+		if model := file.EmbeddedWith(); model != "" {
+			embeddings[fmt.Sprintf("%s (%d dimensions)", model, len(file.Embedding))]++
+		}
+	}
+	for embedding, count := range embeddings {
+		fmt.Printf("%s %s: %d files\n", fileinfo.Yellow("Embeddings :"), embedding, count)
+	}
+
+	if len(undescribed) == 0 && len(metadataOnly) == 0 {
+		fmt.Println(fileinfo.Green("\nAll indexed files have descriptions.\n"))
+		return nil
+	}
+
+	fmt.Println(fileinfo.Cyan("\n----------------------------------------------------------------------------------------------------------------------------------\n"))
+	for _, file := range append(undescribed, metadataOnly...) {
+		status := string(file.Status)
+		if file.Status == fileinfo.StatusUnknown {
+			status = "unknown"
+		}
+		reason := file.StatusReason
+		if reason == "" {
+			reason = "no description recorded"
+		}
+
+		fmt.Printf("%s %s\n%s %s\n%s %s\n%s %s\n\n", fileinfo.Yellow("File :"), file.Name, fileinfo.Yellow("File path :"), filepath.Join(file.Directory, file.Name), fileinfo.Yellow("Status :"), status, fileinfo.Yellow("Reason :"), reason)
+	}
+
+	if len(undescribed) > 0 {
+		fmt.Println(fileinfo.Blue("Run 'gencli index --retry-metadata' to describe these files from their metadata instead.\n"))
+	}
 
 	return nil
 }
 
+// indexMigrateCmd upgrades the index database, or with checkOnly lists the
+// migrations it needs and fails if there are any.
+func indexMigrateCmd(checkOnly bool) error {
+	status, err := fileinfo.CheckSchema()
+	if err != nil {
+		return err
+	}
+	if !status.Outdated() {
+		if status.Exists {
+			fmt.Println(fileinfo.Green(fmt.Sprintf("The index is up to date (schema %d)", status.Version)))
+		} else {
+			fmt.Println(fileinfo.Green(fmt.Sprintf("No index yet; it will be created with schema %d", fileinfo.SchemaVersion)))
+		}
+		return nil
+	}
+
+	if len(status.Imports) > 0 {
+		fmt.Printf("%s %s\n", fileinfo.Yellow("Legacy index :"), strings.Join(status.Imports, ", "))
+		fmt.Printf("  %s import into a new index with schema %d\n", fileinfo.Cyan("1."), fileinfo.SchemaVersion)
+	} else {
+		fmt.Printf("%s %d\n%s %d\n", fileinfo.Yellow("Index schema :"), status.Version, fileinfo.Yellow("Current schema :"), fileinfo.SchemaVersion)
+		for i, description := range status.Pending {
+			fmt.Printf("  %s %s\n", fileinfo.Cyan(fmt.Sprintf("%d.", status.Version+i+1)), description)
+		}
+	}
+
+	if checkOnly && len(status.Imports) > 0 {
+		return fmt.Errorf("the legacy JSON index has not been imported; run 'gencli index migrate' to import it")
+	} else if checkOnly {
+		return fmt.Errorf("the index needs %d migrations; run 'gencli index migrate' to apply them", len(status.Pending))
+	}
+
+	store, err := fileinfo.OpenStore()
+	if err != nil {
+		return err
+	}
+	return store.Close()
+}
+
 func shouldSkip(fileName string, skipTypes []string, skipFiles []string) bool {
 	for _, skipType := range skipTypes {
 		if strings.HasSuffix(fileName, skipType) {
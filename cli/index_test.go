@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
+)
+
+// fixtureTime is the modification time given to copied test files, as the
+// description prompts include it.
+var fixtureTime = time.Date(2024, 4, 2, 9, 30, 0, 0, time.UTC)
+
+// setupReplay runs a test against the cassettes in testdata, or records them
+// again when GENCLI_CASSETTE_MODE=record and GEMINI_API_KEY are set. It gives
+// the test its own home directory and a working directory holding a copy of
+// testdata/docs at the relative path "docs", so paths and times in the
+// recorded prompts are the same on every machine. It returns the API key to
+// use, a placeholder when replaying.
+func setupReplay(t *testing.T) string {
+	t.Helper()
+
+	mode := os.Getenv("GENCLI_CASSETTE_MODE")
+	if mode == "" {
+		mode = gemini.CassetteReplay
+	}
+	apiKey := "replay"
+	if mode == gemini.CassetteRecord {
+		apiKey = os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			t.Skip("recording cassettes needs GEMINI_API_KEY")
+		}
+	}
+
+	cassettes, err := filepath.Abs(filepath.Join("testdata", "cassettes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := filepath.Abs(filepath.Join("testdata", "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	work := t.TempDir()
+	copyFixtures(t, docs, filepath.Join(work, "docs"))
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+
+	// Whether .txt is text otherwise depends on the system's mime.types
+	if err := mime.AddExtensionType(".txt", "text/plain; charset=utf-8"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gemini.UseCassettes(mode, cassettes); err != nil {
+		t.Fatal(err)
+	}
+	return apiKey
+}
+
+// copyFixtures copies the files under src to dst with fixtureTime as their
+// modification time.
+func copyFixtures(t *testing.T, src, dst string) {
+	t.Helper()
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+		return os.Chtimes(target, fixtureTime, fixtureTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexFilesReplay(t *testing.T) {
+	apiKey := setupReplay(t)
+
+	config := &ConfigData{
+		Directories:    []string{"docs"},
+		APIKeys:        []string{apiKey},
+		EmbeddingModel: gemini.DefaultEmbeddingModel,
+	}
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := indexFiles(fileinfo.NewHashSet(), &indexOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		filepath.Join("docs", "meeting-notes.txt"):               true,
+		filepath.Join("docs", "archive", "invoice-2024-031.txt"): true,
+		filepath.Join("docs", "archive", "blob.bin"):             false,
+	}
+	if len(files) != len(want) {
+		t.Fatalf("indexed %d files, want %d", len(files), len(want))
+	}
+
+	ids := make(map[int]string)
+	for _, file := range files {
+		path := filepath.Join(file.Directory, file.Name)
+		hasText, ok := want[path]
+		if !ok {
+			t.Errorf("unexpected file %s in the index", path)
+			continue
+		}
+
+		if !file.HasDescription() {
+			t.Errorf("%s has no description: %s", path, file.StatusReason)
+		}
+		if got := file.EmbeddedWith(); got != gemini.DefaultEmbeddingModel {
+			t.Errorf("%s embedded with %q, want %q", path, got, gemini.DefaultEmbeddingModel)
+		}
+		// Only text files are split into passages
+		if hasText != (len(file.Chunks) > 0) {
+			t.Errorf("%s has %d chunks", path, len(file.Chunks))
+		}
+		if file.Id == 0 || ids[file.Id] != "" {
+			t.Errorf("%s has ID %d, already used by %q", path, file.Id, ids[file.Id])
+		}
+		ids[file.Id] = path
+	}
+
+	// Nothing changed, so a second run keeps every entry with its ID
+	if err := indexFiles(fileinfo.NewHashSet(), &indexOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(files) {
+		t.Fatalf("second run indexed %d files, want %d", len(again), len(files))
+	}
+	for _, file := range again {
+		path := filepath.Join(file.Directory, file.Name)
+		if ids[file.Id] != path {
+			t.Errorf("%s has ID %d after the second run, which was %q", path, file.Id, ids[file.Id])
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	minOrganizeGroups = 2
+	maxOrganizeGroups = 10
+	maxFolderName     = 40
+)
+
+type organizeOpts struct {
+	Groups    int
+	Recursive bool
+	Yes       bool
+	DryRun    bool
+	Undo      bool
+}
+
+// fileMove is a single rename made by organize. Paths are absolute. Pending
+// marks a planned move not yet confirmed as made when the journal was written.
+type fileMove struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Pending bool   `json:"pending,omitempty"`
+}
+
+// organizeRun is one applied organize plan, journalled so it can be undone.
+// CreatedDirs are the folders the run created, removed again on undo if empty.
+type organizeRun struct {
+	Time        time.Time  `json:"time"`
+	Root        string     `json:"root"`
+	Moves       []fileMove `json:"moves"`
+	CreatedDirs []string   `json:"createdDirs,omitempty"`
+}
+
+func organizeCmd(hs *fileinfo.HashSet, args []string, opts *organizeOpts) error {
+	if opts.Undo {
+		return undoOrganize(hs)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no directory provided")
+	}
+
+	run, err := planOrganize(args[0], opts)
+	if err != nil {
+		return err
+	}
+	if len(run.Moves) == 0 {
+		fmt.Println(fileinfo.Green("\nFiles are already organised"))
+		return nil
+	}
+
+	fmt.Print(formatOrganizePlan(run))
+	if opts.DryRun {
+		return nil
+	}
+
+	if !opts.Yes {
+		fmt.Print(fileinfo.Blue(fmt.Sprintf("\nMove %d files? [y/N]: ", len(run.Moves))))
+
+		response := readResponse()
+		if !strings.EqualFold(strings.TrimSpace(response), "y") {
+			fmt.Println(fileinfo.Yellow("Cancelled"))
+			return nil
+		}
+	}
+
+	return applyOrganize(hs, run)
+}
+
+// planOrganize clusters the indexed files in dir by embedding, asks the model
+// to name a folder for each cluster and plans moving every file into its
+// cluster's folder. Files without an embedding stay where they are.
+func planOrganize(dir string, opts *organizeOpts) (*organizeRun, error) {
+	root, err := fileinfo.ExpandDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	indexedFiles, err := LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index : %w", err)
+	}
+
+	var files []fileinfo.FileInfo
+	var vectors [][]float32
+	unembedded := 0
+	for _, file := range indexedFiles {
+		fileDir, err := filepath.Abs(file.Directory)
+		if err != nil {
+			continue
+		}
+		if fileDir != root && !(opts.Recursive && strings.HasPrefix(fileDir, root+string(filepath.Separator))) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(fileDir, file.Name)); err != nil {
+			continue
+		}
+		if !file.HasDescription() || len(file.Embedding) == 0 {
+			unembedded++
+			continue
+		}
+		files = append(files, file)
+		vectors = append(vectors, file.Embedding)
+	}
+
+	if unembedded > 0 {
+		fmt.Println(fileinfo.Yellow(fmt.Sprintf("%d files without a description will be left in place", unembedded)))
+	}
+	if len(files) < 2*minOrganizeGroups {
+		return nil, fmt.Errorf("too few indexed files in %s to organise; run 'gencli index' first", root)
+	}
+
+	groupCount := opts.Groups
+	if groupCount <= 0 {
+		groupCount = int(math.Round(math.Sqrt(float64(len(files)) / 2)))
+		groupCount = max(minOrganizeGroups, min(groupCount, maxOrganizeGroups))
+	}
+
+	assignment := fileinfo.ClusterVectors(vectors, groupCount)
+	byCluster := make(map[int][]fileinfo.FileInfo)
+	for i, cluster := range assignment {
+		if cluster >= 0 {
+			byCluster[cluster] = append(byCluster[cluster], files[i])
+		}
+	}
+
+	clusterIDs := make([]int, 0, len(byCluster))
+	for id := range byCluster {
+		clusterIDs = append(clusterIDs, id)
+	}
+	sort.Ints(clusterIDs)
+
+	groups := make([][]fileinfo.FileInfo, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		groups = append(groups, byCluster[id])
+	}
+
+	names := folderNames(groups)
+
+	run := &organizeRun{Root: root}
+	planned := make(map[string]bool)
+	for g, group := range groups {
+		folder := filepath.Join(root, names[g])
+		for _, file := range group {
+			from, _ := filepath.Abs(filepath.Join(file.Directory, file.Name))
+			if filepath.Dir(from) == folder {
+				continue
+			}
+
+			to := uniquePath(filepath.Join(folder, file.Name), planned)
+			planned[to] = true
+			run.Moves = append(run.Moves, fileMove{From: from, To: to})
+		}
+	}
+
+	return run, nil
+}
+
+// folderNames asks the model to name each group, falling back to numbered
+// names, and makes the names safe and distinct.
+func folderNames(groups [][]fileinfo.FileInfo) []string {
+	var names []string
+
+	config, err := LoadConfig()
+	if err == nil && len(config.APIKeys) > 0 {
+		names, err = gemini.NameFolders(groups, config.APIKeys[0])
+	} else if err == nil {
+		err = fmt.Errorf("no apikeys provided")
+	}
+	if err != nil {
+		fmt.Println(fileinfo.Yellow(fmt.Sprintf("Using numbered folder names : %v", err)))
+		names = make([]string, len(groups))
+	}
+
+	used := make(map[string]bool)
+	for i, name := range names {
+		name = sanitizeFolderName(name)
+		if name == "" {
+			name = fmt.Sprintf("Group %d", i+1)
+		}
+
+		unique := name
+		for n := 2; used[strings.ToLower(unique)]; n++ {
+			unique = fmt.Sprintf("%s %d", name, n)
+		}
+		used[strings.ToLower(unique)] = true
+		names[i] = unique
+	}
+
+	return names
+}
+
+// sanitizeFolderName strips characters that are not allowed in folder names
+// on common filesystems.
+func sanitizeFolderName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+
+	if len(name) > maxFolderName {
+		name = strings.ToValidUTF8(name[:maxFolderName], "")
+	}
+	return strings.Trim(name, " .")
+}
+
+// uniquePath returns path, or path with " (n)" before its extension if a
+// file already exists there or another move targets it.
+func uniquePath(path string, planned map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	candidate := path
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) && !planned[candidate] {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// formatOrganizePlan shows the moves as a diff grouped by target folder.
+func formatOrganizePlan(run *organizeRun) string {
+	byFolder := make(map[string][]fileMove)
+	var folders []string
+	for _, move := range run.Moves {
+		folder := filepath.Dir(move.To)
+		if _, ok := byFolder[folder]; !ok {
+			folders = append(folders, folder)
+		}
+		byFolder[folder] = append(byFolder[folder], move)
+	}
+	sort.Strings(folders)
+
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(run.Root, path); err == nil {
+			return rel
+		}
+		return path
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("\n%s\n", fileinfo.Green(fmt.Sprintf("Proposed layout for %s -", run.Root))))
+	for _, folder := range folders {
+		moves := byFolder[folder]
+		builder.WriteString(fmt.Sprintf("\n%s %s\n", fileinfo.Cyan(relative(folder)+string(filepath.Separator)), fileinfo.Gray(fmt.Sprintf("(%d files)", len(moves)))))
+		for _, move := range moves {
+			builder.WriteString(fmt.Sprintf("  %s\n  %s\n", fileinfo.Red("- "+relative(move.From)), fileinfo.Green("+ "+relative(move.To))))
+		}
+	}
+	return builder.String()
+}
+
+// applyOrganize carries out the moves, journals them and updates the index.
+// The planned run is journalled before the first rename and each move is
+// marked done as it is made, so an interrupted run can still be undone.
+func applyOrganize(hs *fileinfo.HashSet, run *organizeRun) error {
+	lock, err := fileinfo.LockConfigDir("organizing")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	run.Time = time.Now()
+	for i := range run.Moves {
+		run.Moves[i].Pending = true
+	}
+
+	journal, err := loadOrganizeJournal()
+	if err != nil {
+		return fmt.Errorf("failed to load organize journal : %w", err)
+	}
+	journal = append(journal, *run)
+	entry := len(journal) - 1
+	if err := saveOrganizeJournal(journal); err != nil {
+		return fmt.Errorf("failed to save organize journal : %w", err)
+	}
+
+	var done []fileMove
+	var skipped int
+	var moveErr error
+	for i := range run.Moves {
+		move := &run.Moves[i]
+
+		// The plan may be stale by now, and os.Rename replaces an existing
+		// target on Unix
+		if _, err := os.Lstat(move.To); err == nil {
+			fmt.Println(fileinfo.Red(fmt.Sprintf("Not moving %s : %s already exists", move.From, move.To)))
+			skipped++
+			continue
+		}
+
+		dir := filepath.Dir(move.To)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				moveErr = err
+				break
+			}
+			run.CreatedDirs = append(run.CreatedDirs, dir)
+		}
+
+		if err := os.Rename(move.From, move.To); err != nil {
+			moveErr = err
+			break
+		}
+		move.Pending = false
+		done = append(done, fileMove{From: move.From, To: move.To})
+
+		journal[entry] = *run
+		if err := saveOrganizeJournal(journal); err != nil {
+			moveErr = fmt.Errorf("failed to save organize journal : %w", err)
+			break
+		}
+	}
+
+	// Only the moves actually made stay in the journal
+	run.Moves = done
+	if len(done) > 0 {
+		journal[entry] = *run
+	} else {
+		journal = journal[:entry]
+	}
+	if err := saveOrganizeJournal(journal); err != nil {
+		return fmt.Errorf("failed to save organize journal : %w", err)
+	}
+
+	if len(done) > 0 {
+		if err := relocateIndexedFiles(hs, done); err != nil {
+			return err
+		}
+	}
+
+	if moveErr != nil {
+		return fmt.Errorf("stopped after %d moves : %w", len(done), moveErr)
+	}
+
+	fmt.Println(fileinfo.Green(fmt.Sprintf("\nMoved %d files. Run 'gencli organize --undo' to restore the previous layout.", len(done))))
+	if skipped > 0 {
+		return fmt.Errorf("%d files were not moved because their target already exists", skipped)
+	}
+	return nil
+}
+
+// undoOrganize reverses the most recent organize run. Moves that cannot be
+// reversed stay in the journal so undo can be retried. A pending move left by
+// an interrupted run is only reversed if the file is found at its target.
+func undoOrganize(hs *fileinfo.HashSet) error {
+	lock, err := fileinfo.LockConfigDir("undoing an organize run")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	journal, err := loadOrganizeJournal()
+	if err != nil {
+		return fmt.Errorf("failed to load organize journal : %w", err)
+	}
+	if len(journal) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	run := journal[len(journal)-1]
+
+	var restored, remaining []fileMove
+	for i := len(run.Moves) - 1; i >= 0; i-- {
+		move := run.Moves[i]
+		if move.Pending && !movedOnDisk(move) {
+			continue
+		}
+		move.Pending = false
+
+		if _, err := os.Lstat(move.From); err == nil {
+			fmt.Println(fileinfo.Red(fmt.Sprintf("Not restoring %s : a file already exists there", move.From)))
+			remaining = append(remaining, move)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(move.From), 0755); err != nil {
+			remaining = append(remaining, move)
+			continue
+		}
+		if err := os.Rename(move.To, move.From); err != nil {
+			fmt.Println(fileinfo.Red(fmt.Sprintf("Not restoring %s : %v", move.From, err)))
+			remaining = append(remaining, move)
+			continue
+		}
+		restored = append(restored, fileMove{From: move.To, To: move.From})
+	}
+
+	// Created folders are only removed once empty
+	for i := len(run.CreatedDirs) - 1; i >= 0; i-- {
+		os.Remove(run.CreatedDirs[i])
+	}
+
+	if len(remaining) == 0 {
+		journal = journal[:len(journal)-1]
+	} else {
+		journal[len(journal)-1].Moves = remaining
+	}
+	if err := saveOrganizeJournal(journal); err != nil {
+		return fmt.Errorf("failed to save organize journal : %w", err)
+	}
+
+	if err := relocateIndexedFiles(hs, restored); err != nil {
+		return err
+	}
+
+	fmt.Println(fileinfo.Green(fmt.Sprintf("\nRestored %d files in %s", len(restored), run.Root)))
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d files could not be restored", len(remaining))
+	}
+	return nil
+}
+
+// movedOnDisk reports whether a move was made: the source is gone and the
+// target exists.
+func movedOnDisk(move fileMove) bool {
+	if _, err := os.Lstat(move.From); err == nil {
+		return false
+	}
+	_, err := os.Lstat(move.To)
+	return err == nil
+}
+
+// relocateIndexedFiles updates the paths of moved files in the index, keeping
+// their descriptions and embeddings, and refreshes the search indexes. The
+// caller holds the config directory lock.
+func relocateIndexedFiles(hs *fileinfo.HashSet, moves []fileMove) error {
+	if err := hs.Load(); err != nil {
+		return fmt.Errorf("failed to load hash set : %w", err)
+	}
+
+	files, err := LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index : %w", err)
+	}
+
+	byPath := make(map[string]int, len(files))
+	for i, file := range files {
+		if path, err := filepath.Abs(filepath.Join(file.Directory, file.Name)); err == nil {
+			byPath[path] = i
+		}
+	}
+
+	var moved []fileinfo.FileInfo
+	var oldPaths []string
+	for _, move := range moves {
+		i, ok := byPath[move.From]
+		if !ok {
+			continue
+		}
+		file := &files[i]
+		hs.Remove(fileinfo.GenerateFileHash(*file))
+		oldPaths = append(oldPaths, filepath.Join(file.Directory, file.Name))
+
+		// The directory keeps the form it was indexed in, relative or absolute
+		if rel, err := filepath.Rel(filepath.Dir(move.From), filepath.Dir(move.To)); err == nil {
+			file.Directory = filepath.Join(file.Directory, rel)
+		} else {
+			file.Directory = filepath.Dir(move.To)
+		}
+		file.Name = filepath.Base(move.To)
+
+		hs.Add(fileinfo.GenerateFileHash(*file))
+		moved = append(moved, *file)
+	}
+
+	if err := UpdateIndex(moved, oldPaths); err != nil {
+		return fmt.Errorf("failed to store index : %w", err)
+	}
+	// Saved now as well, since the hash set is only saved when a command succeeds
+	if err := hs.Save(); err != nil {
+		return fmt.Errorf("failed to store hash set : %w", err)
+	}
+
+	if err := fileinfo.BuildKeywordIndex(files).SaveToFile(); err != nil {
+		return fmt.Errorf("failed to store keyword index : %w", err)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config : %w", err)
+	}
+	graph, err := fileinfo.LoadVectorIndex()
+	if err != nil {
+		graph = nil
+	}
+	if err := graph.Sync(files, config.embeddingModel()).SaveToFile(); err != nil {
+		return fmt.Errorf("failed to store vector index : %w", err)
+	}
+
+	return nil
+}
+
+func loadOrganizeJournal() ([]organizeRun, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var journal []organizeRun
+
+	data, err := os.ReadFile(filepath.Join(configDir, ".gencli-organize-journal.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return journal, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func saveOrganizeJournal(journal []organizeRun) error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileinfo.WriteFileAtomic(filepath.Join(configDir, ".gencli-organize-journal.json"), jsonData, 0644)
+}
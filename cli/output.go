@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoMatch is returned by search when nothing matched confidently. The
+// command exits with ExitNoMatch instead of ExitError for it.
+var ErrNoMatch = errors.New("no matches found")
+
+// Exit codes of gencli, for scripts calling it.
+const (
+	ExitOK      = 0 // success; for search, at least one confident match
+	ExitNoMatch = 1 // search found no confident match
+	ExitError   = 2 // any other failure
+)
+
+// Machine-readable output formats accepted by --output.
+const (
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputTSV    = "tsv"
+	outputPaths  = "paths"
+)
+
+var outputFormats = []string{outputJSON, outputNDJSON, outputTSV, outputPaths}
+
+// hitRecord is the JSON form of a search hit.
+type hitRecord struct {
+	Rank         int            `json:"rank"`
+	ID           int            `json:"id"`
+	Path         string         `json:"path"`
+	Name         string         `json:"name"`
+	Directory    string         `json:"directory"`
+	Size         int64          `json:"size"`
+	ModifiedTime time.Time      `json:"modifiedTime"`
+	Score        float32        `json:"score"`
+	Similarity   float32        `json:"similarity,omitempty"`
+	KeywordScore float64        `json:"keywordScore,omitempty"`
+	Confident    bool           `json:"confident"`
+	Description  string         `json:"description"`
+	Passage      *passageRecord `json:"passage,omitempty"`
+	Reason       string         `json:"reason,omitempty"`
+	New          bool           `json:"new,omitempty"`
+}
+
+type passageRecord struct {
+	Page   int    `json:"page,omitempty"`
+	Offset int    `json:"offset"`
+	Text   string `json:"text"`
+}
+
+// outputOpts are the scripting flags of the commands that list files.
+type outputOpts struct {
+	Output         string
+	NullSeparated  bool
+	NonInteractive bool
+}
+
+// outputFormat checks the --output and -0 flags and returns the format to
+// write, or "" for the interactive display.
+func (opts *outputOpts) outputFormat() (string, error) {
+	format := strings.ToLower(opts.Output)
+	if format != "" && !contains(outputFormats, format) {
+		return "", fmt.Errorf("unknown output format %q (want one of %s)", opts.Output, strings.Join(outputFormats, ", "))
+	}
+
+	if opts.NullSeparated {
+		if format != "" && format != outputPaths {
+			return "", fmt.Errorf("-0 can only be used with --output paths")
+		}
+		format = outputPaths
+	}
+	return format, nil
+}
+
+// writeHits writes hits in a machine-readable format. confident says
+// whether the hits are confident matches rather than nearest candidates.
+func writeHits(w io.Writer, hits []searchHit, format string, nullSeparated bool, confident bool) error {
+	switch format {
+	case outputJSON:
+		records := make([]hitRecord, len(hits))
+		for i, hit := range hits {
+			records[i] = newHitRecord(i+1, hit, confident)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+
+	case outputNDJSON:
+		encoder := json.NewEncoder(w)
+		for i, hit := range hits {
+			if err := encoder.Encode(newHitRecord(i+1, hit, confident)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case outputTSV:
+		// rank, score, path, description; tabs and newlines inside fields become spaces
+		for i, hit := range hits {
+			if _, err := fmt.Fprintf(w, "%d\t%.4f\t%s\t%s\n", i+1, hit.Relevance, tsvField(hitPath(hit)), tsvField(hit.File.Description)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case outputPaths:
+		separator := "\n"
+		if nullSeparated {
+			separator = "\x00"
+		}
+		for _, hit := range hits {
+			if _, err := io.WriteString(w, hitPath(hit)+separator); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func newHitRecord(rank int, hit searchHit, confident bool) hitRecord {
+	record := hitRecord{
+		Rank:         rank,
+		ID:           hit.File.Id,
+		Path:         filepath.Join(hit.File.Directory, hit.File.Name),
+		Name:         hit.File.Name,
+		Directory:    hit.File.Directory,
+		Size:         hit.File.Size,
+		ModifiedTime: hit.File.ModifiedTime,
+		Score:        hit.Relevance,
+		Similarity:   hit.Similarity,
+		KeywordScore: hit.KeywordScore,
+		Confident:    confident,
+		Description:  hit.File.Description,
+		Reason:       hit.Reason,
+		New:          hit.New,
+	}
+	if hit.Passage != nil {
+		record.Passage = &passageRecord{Page: hit.Passage.Page, Offset: hit.Passage.Offset, Text: hit.Passage.Text}
+	}
+	return record
+}
+
+func tsvField(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\t' || r == '\n' || r == '\r'
+	}), " ")
+}
+
+// describedFiles wraps the files that have a description as hits, for
+// listing the whole index in a machine-readable format.
+func describedFiles(files []fileinfo.FileInfo) []searchHit {
+	var hits []searchHit
+	for _, file := range files {
+		if file.HasDescription() {
+			hits = append(hits, searchHit{File: file})
+		}
+	}
+	return hits
+}
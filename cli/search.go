@@ -1,16 +1,163 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"gemini_cli_tool/fileinfo"
 	"gemini_cli_tool/gemini"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-func searchFilesCmd(cmd *cobra.Command, args []string) error {
+const (
+	defaultSearchLimit = 5
+	defaultRerankTop   = 20
+)
+
+type searchOpts struct {
+	Limit       int
+	MinScore    float32
+	Nearest     bool
+	KeywordOnly bool
+	VectorOnly  bool
+	NoBrowser   bool
+	Rerank      bool
+	RerankTop   int
+
+	// Output for scripts: a machine-readable format, and never prompting
+	outputOpts
+
+	// Metadata filters as given on the command line
+	searchFilters
+}
+
+// searchFilters are the metadata filter flags of a search, kept in their
+// command-line form so history and saved searches can replay them.
+type searchFilters struct {
+	Dirs           []string `json:"dirs,omitempty"`
+	Exts           []string `json:"exts,omitempty"`
+	Types          []string `json:"types,omitempty"`
+	MinSize        string   `json:"minSize,omitempty"`
+	MaxSize        string   `json:"maxSize,omitempty"`
+	ModifiedAfter  string   `json:"modifiedAfter,omitempty"`
+	ModifiedBefore string   `json:"modifiedBefore,omitempty"`
+}
+
+// parseSearchCommand splits the arguments of chat's $search into the query
+// and the same flags the search command accepts. The nearest candidates are
+// shown by default, since there is no exit code to check in chat.
+func parseSearchCommand(input string) (string, *searchOpts, error) {
+	var opts searchOpts
+
+	flags := pflag.NewFlagSet(systemCmdSearch, pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	addSearchFlags(flags, &opts)
+	opts.Nearest = true
+
+	args, err := splitArgs(input)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := flags.Parse(args); err != nil {
+		return "", nil, err
+	}
+
+	query := joinQueryArgs(flags.Args())
+	if query == "" {
+		return "", nil, fmt.Errorf("no search query provided")
+	}
+
+	return query, &opts, nil
+}
+
+// splitArgs splits input on whitespace like a shell would, keeping text in
+// single or double quotes together.
+func splitArgs(input string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range input {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// filter parses the metadata filter flags.
+func (opts *searchOpts) filter() (fileinfo.Filter, error) {
+	var filter fileinfo.Filter
+	var err error
+
+	for _, dir := range opts.Dirs {
+		dir, err = fileinfo.ExpandDir(dir)
+		if err != nil {
+			return filter, err
+		}
+		filter.Dirs = append(filter.Dirs, dir)
+	}
+	filter.Exts = opts.Exts
+	filter.Types = opts.Types
+
+	if opts.MinSize != "" {
+		if filter.MinSize, err = fileinfo.ParseSize(opts.MinSize); err != nil {
+			return filter, err
+		}
+	}
+	if opts.MaxSize != "" {
+		if filter.MaxSize, err = fileinfo.ParseSize(opts.MaxSize); err != nil {
+			return filter, err
+		}
+	}
+	if opts.ModifiedAfter != "" {
+		if filter.ModifiedAfter, err = fileinfo.ParseDate(opts.ModifiedAfter); err != nil {
+			return filter, err
+		}
+	}
+	if opts.ModifiedBefore != "" {
+		if filter.ModifiedBefore, err = fileinfo.ParseDate(opts.ModifiedBefore); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, filter.Validate()
+}
+
+func searchFilesCmd(cmd *cobra.Command, args []string, opts *searchOpts) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no search query provided")
 	}
@@ -18,82 +165,458 @@ func searchFilesCmd(cmd *cobra.Command, args []string) error {
 	// 	fmt.Print(args[0])
 	// }
 
-	query := args[0]
+	return runSearch(joinQueryArgs(args), opts, "")
+}
 
-	file, err := searchFiles(query)
+// runSearch searches for query, records it in the history and shows the
+// results. When savedName names a saved search, results it did not return on
+// its previous run are marked as new and the run is remembered.
+func runSearch(query string, opts *searchOpts, savedName string) error {
+	format, err := opts.outputFormat()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("\n%s \n\n%s %s\n\n%s %s\\%s\n\n%s %s\n", fileinfo.Green("Most relevelent file is -"), fileinfo.Yellow("File :"), file.Name, fileinfo.Yellow("File path :"), file.Directory, file.Name, fileinfo.Yellow("Description :"), file.Description)
-	fmt.Print(fileinfo.Blue("\nEnter 'y' to open this file, or any other key to cancel: "))
+	hits, warnings, err := searchFiles(query, opts)
+	nearest := errors.Is(err, gemini.ErrNoConfidentMatch)
+	if err != nil && !nearest {
+		return err
+	}
 
-	var response string
-	fmt.Scanln(&response)
+	recordSearch(query, opts.searchFilters, hits)
 
-	if strings.ToLower(response) == "y" {
-		filepath := filepath.Join(file.Directory, file.Name)
-		err = OpenFileWithDefaultApp(filepath)
-		if err != nil {
-			fmt.Print(fileinfo.Red(fmt.Sprintf("Failed to open file: %v", err)))
+	var lastRun time.Time
+	if savedName != "" {
+		lastRun = markNewHits(savedName, hits)
+	}
+
+	// Nearest candidates are shown, but the search still counts as unmatched
+	var result error
+	if nearest {
+		result = fmt.Errorf("%w (showing nearest candidates)", ErrNoMatch)
+	}
+
+	if format != "" {
+		printWarnings(warnings)
+		if err := writeHits(os.Stdout, hits, format, opts.NullSeparated, !nearest); err != nil {
+			return err
 		}
+		return result
 	}
 
-	return nil
+	if !opts.NoBrowser && !opts.NonInteractive && canBrowse() {
+		if err := browseResults(query, opts, hits, warnings, err); err != nil {
+			return err
+		}
+		return result
+	}
+
+	printWarnings(warnings)
+	if nearest {
+		fmt.Printf("\n%s\n\n%s", fileinfo.Yellow("No confident match. Nearest candidates -"), formatSearchHits(hits))
+	} else {
+		fmt.Printf("\n%s\n\n%s", fileinfo.Green("Most relevant files are -"), formatSearchHits(hits))
+	}
+	if !lastRun.IsZero() {
+		fmt.Println(fileinfo.Green(fmt.Sprintf("%d new since the last run on %s", countNewHits(hits), lastRun.Format("2006-01-02 15:04"))))
+	}
+	if opts.NonInteractive || len(hits) == 0 {
+		return result
+	}
+	actions := resultActions()
+	fmt.Print(fileinfo.Blue("\n" + hitPrompt(len(hits), actions)))
+
+	response := readResponse()
+
+	if err := openSelectedHit(hits, actions, response); err != nil {
+		fmt.Print(fileinfo.Red(fmt.Sprintf("Failed to open file: %v", err)))
+	}
+
+	return result
+}
+
+// searchHit is an indexed file returned by a search. Passage is the chunk of
+// its text that matched, when that matched better than the description.
+type searchHit struct {
+	File         fileinfo.FileInfo
+	Similarity   float32
+	Relevance    float32
+	KeywordScore float64
+	Passage      *fileinfo.Chunk
+	Reason       string // the model's justification when re-ranked
+	New          bool   // not returned by the previous run of a saved search
+}
+
+// formatSearchHits renders ranked hits as a numbered list with their scores,
+// paths and a short description.
+func formatSearchHits(hits []searchHit) string {
+	const maxDescription = 200
+
+	var builder strings.Builder
+	for i, hit := range hits {
+		description := strings.Join(strings.Fields(hit.File.Description), " ")
+		if len(description) > maxDescription {
+			description = strings.ToValidUTF8(description[:maxDescription], "") + "..."
+		}
+
+		score := fmt.Sprintf("(score %.2f)", hit.Relevance)
+		if hit.KeywordScore > 0 && hit.Similarity == 0 {
+			score = fmt.Sprintf("(keyword %.2f)", hit.KeywordScore)
+		} else if hit.KeywordScore > 0 {
+			score = fmt.Sprintf("(score %.2f, keyword %.2f)", hit.Relevance, hit.KeywordScore)
+		}
+
+		var newTag string
+		if hit.New {
+			newTag = " " + fileinfo.Green("new")
+		}
+
+		if hit.File.Id > 0 {
+			score = fmt.Sprintf("#%d %s", hit.File.Id, score)
+		}
+
+		builder.WriteString(fmt.Sprintf("%s %s %s%s\n", fileinfo.Cyan(fmt.Sprintf("[%d]", i+1)), hit.File.Name, fileinfo.Gray(score), newTag))
+		builder.WriteString(fmt.Sprintf("    %s %s\n", fileinfo.Yellow("File path :"), filepath.Join(hit.File.Directory, hit.File.Name)))
+		builder.WriteString(fmt.Sprintf("    %s %s\n", fileinfo.Yellow("Description :"), description))
+		if hit.Passage != nil {
+			builder.WriteString(fmt.Sprintf("    %s %s\n", fileinfo.Yellow("Matched passage :"), strings.ReplaceAll(passageSummary(hit.Passage), "\n", "\n    ")))
+		}
+		if hit.Reason != "" {
+			builder.WriteString(fmt.Sprintf("    %s %s\n", fileinfo.Yellow("Why :"), hit.Reason))
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// hitPrompt asks which hit to act on, listing the configured commands.
+func hitPrompt(count int, actions ResultActions) string {
+	prompt := fmt.Sprintf("Enter a number (1-%d) to open that file, add r to reveal it or e to edit it (e.g. 1e)", count)
+	if names := actions.actionNames(); len(names) > 0 {
+		prompt += ", or add a command (" + strings.Join(names, ", ") + ")"
+	}
+	return prompt + ", or any other key to cancel: "
 }
 
-func searchFiles(query string) (*fileinfo.FileInfo, error) {
+// openSelectedHit carries out the answer to hitPrompt: a number opens that
+// hit, and a letter or command name after it picks another action. Anything
+// other than a listed number cancels without error.
+func openSelectedHit(hits []searchHit, actions ResultActions, response string) error {
+	choice, action, ok := parseHitChoice(response)
+	if !ok || choice < 1 || choice > len(hits) {
+		return nil
+	}
+
+	return runHitAction(actions, action, hits[choice-1])
+}
+
+// resultActions returns the configured result actions, or the defaults when
+// there is no usable config.
+func resultActions() ResultActions {
+	config, err := LoadConfig()
+	if err != nil {
+		return ResultActions{}
+	}
+	return config.Actions
+}
+
+// searchFiles ranks the index against query, fusing the keyword and vector
+// rankings unless opts forces one of them. With opts.Nearest, the nearest
+// candidates are returned alongside gemini.ErrNoConfidentMatch when nothing
+// matches confidently. Warnings about parts of the search that were skipped
+// are returned for the caller to show.
+func searchFiles(query string, opts *searchOpts) ([]searchHit, []string, error) {
 	// spinners.start()
 
-	files, err := LoadIndex()
+	// Warnings are returned rather than printed, as the browser may own the screen
+	var warnings []string
+	warn := func(message string) { warnings = append(warnings, message) }
+
+	if opts.KeywordOnly && opts.VectorOnly {
+		return nil, nil, fmt.Errorf("--keyword-only and --vector-only cannot be used together")
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Operators in the query become filters; the remaining text is ranked
+	parsed, err := fileinfo.ParseQuery(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid query : %w", err)
+	}
+	query = parsed.Text
+
+	// Embeddings are read later, for the files that need them
+	indexedFiles, err := LoadIndexMetadata()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load index : %w", err)
+		return nil, nil, fmt.Errorf("failed to load index : %w", err)
+	}
+
+	// Filters narrow the candidates before anything is ranked
+	var files []fileinfo.FileInfo
+	for _, file := range indexedFiles {
+		if filter.Match(file) && parsed.Match(file) {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("%w : no indexed files match the filters", ErrNoMatch)
+	}
+
+	if query == "" {
+		hits := filteredFiles(files, opts.Limit)
+		if len(hits) == 0 {
+			return nil, nil, fmt.Errorf("%w : none of the %d files matching the filters is described yet", ErrNoMatch, len(files))
+		}
+		return hits, nil, nil
 	}
 
 	config, err := LoadConfig()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Vector ranking: every file with its calibrated relevance
+	var vectorResults []gemini.SearchResult
+	var vectorErr error
+	if !opts.KeywordOnly {
+		apiKeys := config.APIKeys
+		if apiKeys == nil {
+			return nil, nil, fmt.Errorf("no apikeys provided")
+		}
+		defaultApiKey := apiKeys[0]
+
+		threshold := config.relevanceThreshold()
+		if opts.MinScore > 0 {
+			threshold = opts.MinScore
+		}
+
+		// Without a usable graph every file is scanned, which is only slower
+		graph, err := fileinfo.LoadVectorIndex()
+		if err != nil {
+			warn(fmt.Sprintf("Ignoring vector index : %v. Run 'gencli index' to rebuild it.", err))
+			graph = nil
+		}
+		defer graph.Close()
+
+		vectorResults, vectorErr = gemini.SearchRelevantFiles(files, query, threshold, config.embeddingModel(), 0, graph, loadEmbeddings, warn, defaultApiKey)
+		if vectorErr != nil && !errors.Is(vectorErr, gemini.ErrNoConfidentMatch) {
+			return nil, nil, fmt.Errorf("search failed : %w", vectorErr)
+		}
+	}
+
+	// Keyword ranking over names, paths and descriptions
+	var keywordMatches []fileinfo.KeywordMatch
+	if !opts.VectorOnly {
+		keywords, err := fileinfo.LoadKeywordIndex()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load keyword index : %w", err)
+		}
+		if keywords == nil {
+			keywords = fileinfo.BuildKeywordIndex(files)
+		}
+		keywordMatches = keywords.Search(query)
+	}
+
+	fileIndex := make(map[string]int, len(files))
+	for i, file := range files {
+		fileIndex[filepath.Join(file.Directory, file.Name)] = i
+	}
+
+	vectorByIndex := make(map[int]gemini.SearchResult, len(vectorResults))
+	var vectorRanking []int
+	for _, result := range vectorResults {
+		vectorByIndex[result.Index] = result
+		if vectorErr == nil {
+			vectorRanking = append(vectorRanking, result.Index)
+		}
+	}
+
+	keywordByIndex := make(map[int]float64, len(keywordMatches))
+	var keywordRanking []int
+	for _, match := range keywordMatches {
+		if i, ok := fileIndex[match.Path]; ok {
+			keywordByIndex[i] = match.Score
+			keywordRanking = append(keywordRanking, i)
+		}
+	}
+
+	// The search is confident if the vector side is, or a keyword match
+	// cleared fileinfo.MinKeywordScore, as every returned one does
+	if len(keywordRanking) > 0 {
+		vectorErr = nil
+	}
+
+	ranking := fuseRankings(vectorRanking, keywordRanking)
+	if len(ranking) == 0 {
+		if !errors.Is(vectorErr, gemini.ErrNoConfidentMatch) || !opts.Nearest || len(vectorResults) == 0 {
+			return nil, nil, ErrNoMatch
+		}
+		for _, result := range vectorResults {
+			ranking = append(ranking, result.Index)
+		}
+	}
+
+	hits := make([]searchHit, 0, len(ranking))
+	for _, i := range ranking {
+		result := vectorByIndex[i]
+		hits = append(hits, searchHit{File: files[i], Similarity: result.Similarity, Relevance: result.Relevance, KeywordScore: keywordByIndex[i], Passage: result.Passage})
 	}
 
-	apiKeys := config.APIKeys
-	if apiKeys == nil {
-		return nil, fmt.Errorf("no apikeys provided")
+	if opts.Rerank {
+		hits = rerankHits(query, hits, opts.RerankTop, config, warn)
 	}
-	defaultApiKey := apiKeys[0]
 
-	result, err := gemini.SearchRelevantFiles(files, query, config.RelevanceIndex, defaultApiKey)
+	if opts.Limit > 0 && len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+
+	return hits, warnings, vectorErr
+}
+
+// printWarnings writes the warnings of a search to stderr.
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(warning))
+	}
+}
+
+// filteredFiles lists the described files that passed a query made only of
+// filters, most recently modified first.
+func filteredFiles(files []fileinfo.FileInfo, limit int) []searchHit {
+	hits := describedFiles(files)
+	sort.SliceStable(hits, func(a, b int) bool {
+		return hits[a].File.ModifiedTime.After(hits[b].File.ModifiedTime)
+	})
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// joinQueryArgs joins the words of a query given as separate arguments. When
+// there are several, an argument containing spaces was quoted on the command
+// line and is kept as an exact phrase.
+func joinQueryArgs(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	words := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsFunc(arg, unicode.IsSpace) && !strings.Contains(arg, `"`) {
+			arg = `"` + arg + `"`
+		}
+		words[i] = arg
+	}
+	return strings.Join(words, " ")
+}
+
+// rerankHits has the chat model re-order the top hits and explain each
+// place. If re-ranking fails the hits keep their order and the reason is
+// passed to warn.
+func rerankHits(query string, hits []searchHit, top int, config *ConfigData, warn func(string)) []searchHit {
+	if top <= 0 {
+		top = defaultRerankTop
+	}
+	top = min(top, len(hits))
+	if top < 2 {
+		return hits
+	}
+	if len(config.APIKeys) == 0 {
+		warn("Skipping re-ranking : no apikeys provided")
+		return hits
+	}
+
+	candidates := make([]gemini.RerankCandidate, top)
+	for i, hit := range hits[:top] {
+		candidates[i] = gemini.RerankCandidate{File: hit.File}
+		if hit.Passage != nil {
+			candidates[i].Passage = hit.Passage.Text
+		}
+	}
+
+	order, err := gemini.RerankCandidates(query, candidates, config.APIKeys[0])
 	if err != nil {
-		return nil, fmt.Errorf("search failed : %w", err)
+		warn(fmt.Sprintf("Skipping re-ranking : %v", err))
+		return hits
 	}
 
-	// if len(result) == 0 {
-	// 	fmt.Printf("No results found.")
-	// } else {
-	// 	fmt.Println("Most relevelnt files are : ")
-	// 	for i := range results {
-	// 		fmt.Printf("File : %s ,Directory : %s\n", files[results[i]].Name, files[results[i]].Description)
-	// 	}
-	// }
+	reranked := make([]searchHit, 0, len(hits))
+	for _, r := range order {
+		hit := hits[r.Index]
+		hit.Reason = r.Reason
+		reranked = append(reranked, hit)
+	}
+	return append(reranked, hits[top:]...)
+}
 
-	if result < 0 {
-		return nil, fmt.Errorf("no matches found")
-	} else {
-		return &files[result], nil
+// fuseRankings merges rankings of file indexes by reciprocal rank fusion:
+// each file scores the sum of 1/(k+rank) over the rankings it appears in.
+func fuseRankings(rankings ...[]int) []int {
+	const k = 60
+
+	scores := make(map[int]float64)
+	var fused []int
+	for _, ranking := range rankings {
+		for rank, i := range ranking {
+			if _, seen := scores[i]; !seen {
+				fused = append(fused, i)
+			}
+			scores[i] += 1 / float64(k+rank+1)
+		}
+	}
+
+	sort.SliceStable(fused, func(a, b int) bool {
+		return scores[fused[a]] > scores[fused[b]]
+	})
+	return fused
+}
+
+// passageSummary shows where a matched passage is and the start of its text.
+func passageSummary(passage *fileinfo.Chunk) string {
+	const maxSnippet = 300
+
+	location := fmt.Sprintf("offset %d", passage.Offset)
+	if passage.Page > 0 {
+		location = fmt.Sprintf("page %d, offset %d", passage.Page, passage.Offset)
+	}
+
+	snippet := strings.Join(strings.Fields(passage.Text), " ")
+	if len(snippet) > maxSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxSnippet], "") + "..."
 	}
 
+	return fmt.Sprintf("(%s)\n%s", location, snippet)
 }
 
-func displayAllFiles() error {
+func displayAllFiles(opts *searchOpts) error {
+	format, err := opts.outputFormat()
+	if err != nil {
+		return err
+	}
+
 	files, err := LoadIndex()
 	if err != nil {
 		return fmt.Errorf("failed to load index : %w", err)
 	}
 
+	if format != "" {
+		return writeHits(os.Stdout, describedFiles(files), format, opts.NullSeparated, true)
+	}
+
 	if files == nil {
 		return fmt.Errorf("failed to find any files in index..ifileinfo.ndex the files")
 	}
 
 	for _, file := range files {
+		if !file.HasDescription() {
+			continue
+		}
+
 		fmt.Printf("\n%s %s\n\n%s %s\\%s\n\n%s %s\n", fileinfo.Yellow("File :"), file.Name, fileinfo.Yellow("File path :"), file.Directory, file.Name, fileinfo.Yellow("Description :"), file.Description)
 		fmt.Println(fileinfo.Cyan("----------------------------------------------------------------------------------------------------------------------------------\n"))
 	}
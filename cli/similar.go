@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
+	"os"
+	"path/filepath"
+)
+
+type similarOpts struct {
+	Limit int
+
+	// Output for scripts, as for search
+	outputOpts
+}
+
+func similarFilesCmd(path string, opts *similarOpts) error {
+	format, err := opts.outputFormat()
+	if err != nil {
+		return err
+	}
+
+	// Describing an unindexed file reports progress on stdout, which belongs
+	// to the results in machine-readable output
+	stdout := os.Stdout
+	if format != "" {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+
+	target, hits, err := similarFiles(path, opts)
+	if err != nil {
+		return err
+	}
+	if len(hits) == 0 {
+		return fmt.Errorf("%w : no other indexed file has an embedding from the same model", ErrNoMatch)
+	}
+
+	if format != "" {
+		return writeHits(stdout, hits, format, opts.NullSeparated, true)
+	}
+
+	fmt.Printf("\n%s\n\n%s", fileinfo.Green(fmt.Sprintf("Files most like %s -", target.Name)), formatSearchHits(hits))
+	if opts.NonInteractive {
+		return nil
+	}
+	actions := resultActions()
+	fmt.Print(fileinfo.Blue("\n" + hitPrompt(len(hits), actions)))
+
+	response := readResponse()
+
+	if err := openSelectedHit(hits, actions, response); err != nil {
+		fmt.Print(fileinfo.Red(fmt.Sprintf("Failed to open file: %v", err)))
+	}
+
+	return nil
+}
+
+// similarFiles lists the indexed files nearest to the file named by ref, a
+// path or an indexed file's ID. An indexed file is compared using its stored
+// embedding; any other file is described and embedded first, without being
+// added to the index.
+func similarFiles(ref string, opts *similarOpts) (fileinfo.FileInfo, []searchHit, error) {
+	files, err := LoadIndex()
+	if err != nil {
+		return fileinfo.FileInfo{}, nil, fmt.Errorf("failed to load index : %w", err)
+	}
+
+	path, err := resolveFileRef(ref, files)
+	if err != nil {
+		return fileinfo.FileInfo{}, nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileinfo.FileInfo{}, nil, err
+	}
+	if info.IsDir() {
+		return fileinfo.FileInfo{}, nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	var target fileinfo.FileInfo
+	found := false
+	for _, file := range files {
+		if indexedPath, err := filepath.Abs(filepath.Join(file.Directory, file.Name)); err == nil && indexedPath == path {
+			target, found = file, true
+			break
+		}
+	}
+
+	if !found || len(target.Embedding) == 0 {
+		target, err = embedUnindexedFile(path, info)
+		if err != nil {
+			return target, nil, err
+		}
+	}
+
+	graph, err := fileinfo.LoadVectorIndex()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(fmt.Sprintf("Ignoring vector index : %v. Run 'gencli index' to rebuild it.", err)))
+		graph = nil
+	}
+	defer graph.Close()
+
+	results, err := gemini.SimilarFiles(files, target, opts.Limit, graph)
+	if err != nil {
+		return target, nil, err
+	}
+
+	hits := make([]searchHit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, searchHit{File: files[result.Index], Similarity: result.Similarity, Relevance: result.Relevance, Passage: result.Passage})
+	}
+
+	return target, hits, nil
+}
+
+// embedUnindexedFile describes and embeds a single file with the configured
+// embedding model.
+func embedUnindexedFile(path string, info os.FileInfo) (fileinfo.FileInfo, error) {
+	file := fileinfo.FileInfo{
+		Name:         info.Name(),
+		Directory:    filepath.Dir(path),
+		Size:         info.Size(),
+		ModifiedTime: info.ModTime(),
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return file, fmt.Errorf("failed to load config : %w", err)
+	}
+
+	apiKeys := config.APIKeys
+	if apiKeys == nil {
+		return file, fmt.Errorf("no apikeys provided")
+	}
+
+	fmt.Fprintln(os.Stderr, fileinfo.Yellow(fmt.Sprintf("%s is not indexed; describing it now", file.Name)))
+
+	described := gemini.GenerateDescriptions([]fileinfo.FileInfo{file}, apiKeys[:1], nil, true)
+	if len(described) == 0 {
+		return file, fmt.Errorf("could not describe %s", file.Name)
+	}
+	if !described[0].HasDescription() {
+		return file, fmt.Errorf("could not describe %s : %s %s", file.Name, described[0].Status, described[0].StatusReason)
+	}
+
+	embedded := gemini.GenerateEmbeddings(described, apiKeys[0], config.embeddingModel())
+	if len(embedded) == 0 || len(embedded[0].Embedding) == 0 {
+		return file, fmt.Errorf("could not embed %s", file.Name)
+	}
+
+	return embedded[0], nil
+}
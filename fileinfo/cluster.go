@@ -0,0 +1,110 @@
+package fileinfo
+
+import (
+	"math/rand"
+)
+
+const clusterIterations = 50
+
+// ClusterVectors groups vectors into k clusters by cosine similarity using
+// spherical k-means, seeded with k-means++ so the result is repeatable. It
+// returns the cluster of each vector. Vectors whose dimension differs from
+// the first one are put in the cluster -1.
+func ClusterVectors(vectors [][]float32, k int) []int {
+	assignment := make([]int, len(vectors))
+	if len(vectors) == 0 {
+		return assignment
+	}
+
+	dim := len(vectors[0])
+	var ids []int
+	normalized := make([][]float32, len(vectors))
+	for i, vector := range vectors {
+		if len(vector) != dim {
+			assignment[i] = -1
+			continue
+		}
+		normalized[i] = Normalize(vector)
+		ids = append(ids, i)
+	}
+	k = min(k, len(ids))
+	if k <= 1 {
+		return assignment
+	}
+
+	centroids := seedCentroids(normalized, ids, k)
+	for iteration := 0; iteration < clusterIterations; iteration++ {
+		changed := false
+		for _, i := range ids {
+			best, bestSimilarity := 0, float32(-2)
+			for c, centroid := range centroids {
+				if similarity := Dot(normalized[i], centroid); similarity > bestSimilarity {
+					best, bestSimilarity = c, similarity
+				}
+			}
+			if assignment[i] != best {
+				assignment[i] = best
+				changed = true
+			}
+		}
+		if !changed && iteration > 0 {
+			break
+		}
+
+		sums := make([][]float32, len(centroids))
+		for c := range sums {
+			sums[c] = make([]float32, dim)
+		}
+		for _, i := range ids {
+			for d, x := range normalized[i] {
+				sums[assignment[i]][d] += x
+			}
+		}
+		for c, sum := range sums {
+			// An emptied cluster keeps its old centroid
+			if Dot(sum, sum) > 0 {
+				centroids[c] = Normalize(sum)
+			}
+		}
+	}
+
+	return assignment
+}
+
+// seedCentroids picks k starting centroids, each chosen with probability
+// proportional to its distance from the centroids picked before it.
+func seedCentroids(normalized [][]float32, ids []int, k int) [][]float32 {
+	rng := rand.New(rand.NewSource(1))
+
+	centroids := [][]float32{normalized[ids[rng.Intn(len(ids))]]}
+	distances := make([]float64, len(ids))
+	for len(centroids) < k {
+		var total float64
+		for j, i := range ids {
+			nearest := float32(-2)
+			for _, centroid := range centroids {
+				nearest = max(nearest, Dot(normalized[i], centroid))
+			}
+			distances[j] = float64(max(1-nearest, 0))
+			total += distances[j]
+		}
+
+		// Every remaining vector duplicates a centroid
+		if total == 0 {
+			break
+		}
+
+		target := rng.Float64() * total
+		pick := len(ids) - 1
+		for j, distance := range distances {
+			target -= distance
+			if target <= 0 {
+				pick = j
+				break
+			}
+		}
+		centroids = append(centroids, normalized[ids[pick]])
+	}
+
+	return centroids
+}
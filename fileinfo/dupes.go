@@ -0,0 +1,450 @@
+package fileinfo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	shingleWords   = 5    // words per shingle when comparing extracted text
+	minHashes      = 64   // MinHash signature length; the Jaccard estimate is within about 0.06
+	dupesMinGraph  = 2000 // embeddings of one model compared pairwise below this count
+	dupesNeighbors = 16   // neighbours looked up per file when the graph is used
+
+	// Quantized scores are within about 0.01 of the exact ones; pairs this
+	// close to the threshold are confirmed with the float32 vectors.
+	quantizedMargin = 0.02
+)
+
+// DuplicateKind tells how the files of a cluster were found to be alike.
+type DuplicateKind string
+
+const (
+	// DuplicateExact means every file in the cluster has the same content.
+	DuplicateExact DuplicateKind = "exact"
+	// DuplicateNear means the files have very similar embeddings or text.
+	DuplicateNear DuplicateKind = "near"
+)
+
+// DuplicateFile is a member of a duplicate cluster. Keep marks the most
+// recently modified file, which the reclaimable space assumes is kept.
+type DuplicateFile struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+	Keep         bool      `json:"keep,omitempty"`
+}
+
+// DuplicateCluster is a group of files that are copies or near copies of one
+// another. Similarity is the weakest link that joined the cluster: 1 for exact
+// duplicates, otherwise the embedding similarity or estimated text overlap.
+type DuplicateCluster struct {
+	Kind        DuplicateKind   `json:"kind"`
+	Similarity  float32         `json:"similarity"`
+	Files       []DuplicateFile `json:"files"`
+	TotalSize   int64           `json:"totalSize"`
+	Reclaimable int64           `json:"reclaimable"`
+}
+
+// DuplicateOptions sets how alike two files must be to count as near
+// duplicates. A zero value disables that comparison.
+type DuplicateOptions struct {
+	MinSimilarity float32 // cosine similarity of the description embeddings
+	MinOverlap    float64 // Jaccard overlap of the extracted text's word shingles
+
+	// Quantized compares embeddings as int8 vectors first, reading a quarter
+	// of the memory per comparison, and only scores likely pairs exactly.
+	Quantized bool
+}
+
+// FindExactDuplicates groups files with identical content. Only files sharing
+// a size are read and hashed; files that cannot be read are left out.
+func FindExactDuplicates(files []FileInfo) []DuplicateCluster {
+	bySize := make(map[int64][]int)
+	for i, file := range files {
+		if file.Size > 0 {
+			bySize[file.Size] = append(bySize[file.Size], i)
+		}
+	}
+
+	var clusters []DuplicateCluster
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+
+		byHash := make(map[string][]int)
+		for _, i := range group {
+			hash, err := ContentHash(filepath.Join(files[i].Directory, files[i].Name))
+			if err != nil {
+				continue
+			}
+			byHash[hash] = append(byHash[hash], i)
+		}
+
+		for _, same := range byHash {
+			if len(same) > 1 {
+				clusters = append(clusters, newDuplicateCluster(files, same, DuplicateExact, 1))
+			}
+		}
+	}
+
+	sortClusters(clusters)
+	return clusters
+}
+
+// ContentHash returns the hex SHA-256 of the file's content.
+func ContentHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// partialHashSpan is how much of each end of a file PartialContentHash reads.
+const partialHashSpan = 64 << 10
+
+// PartialContentHash returns the hex SHA-256 of the file's size and its
+// first and last 64 KiB, which tells most files apart without reading them
+// whole. Files up to 128 KiB are hashed entirely.
+func PartialContentHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n", info.Size())
+	if _, err := io.CopyN(hash, file, partialHashSpan); err != nil && err != io.EOF {
+		return "", err
+	}
+	if tail := info.Size() - partialHashSpan; tail > 0 {
+		if _, err := file.Seek(max(tail, partialHashSpan), io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// FindNearDuplicates clusters files whose description embeddings or extracted
+// text are nearly the same, such as successive drafts of a document. Files are
+// linked pairwise and linked files are clustered transitively.
+func FindNearDuplicates(files []FileInfo, opts DuplicateOptions) []DuplicateCluster {
+	var pairs []duplicatePair
+	if opts.MinSimilarity > 0 {
+		pairs = append(pairs, embeddingPairs(files, opts.MinSimilarity, opts.Quantized)...)
+	}
+	if opts.MinOverlap > 0 {
+		pairs = append(pairs, shinglePairs(files, opts.MinOverlap)...)
+	}
+
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for _, pair := range pairs {
+		parent[find(pair.a)] = find(pair.b)
+	}
+
+	members := make(map[int][]int)
+	weakest := make(map[int]float32)
+	for _, pair := range pairs {
+		root := find(pair.a)
+		if score, ok := weakest[root]; !ok || pair.score < score {
+			weakest[root] = pair.score
+		}
+	}
+	for i := range files {
+		root := find(i)
+		if _, linked := weakest[root]; linked {
+			members[root] = append(members[root], i)
+		}
+	}
+
+	var clusters []DuplicateCluster
+	for root, group := range members {
+		clusters = append(clusters, newDuplicateCluster(files, group, DuplicateNear, weakest[root]))
+	}
+
+	sortClusters(clusters)
+	return clusters
+}
+
+type duplicatePair struct {
+	a, b  int
+	score float32
+}
+
+// embeddingPairs links files whose normalised description embeddings, made by
+// the same model, have at least minSimilarity. Large sets are searched through
+// a temporary graph instead of comparing every pair.
+func embeddingPairs(files []FileInfo, minSimilarity float32, quantized bool) []duplicatePair {
+	byModel := make(map[string][]int)
+	for i, file := range files {
+		if model := file.EmbeddedWith(); model != "" && file.HasDescription() {
+			byModel[model] = append(byModel[model], i)
+		}
+	}
+
+	var pairs []duplicatePair
+	for model, group := range byModel {
+		vectors := make([][]float32, len(group))
+		for j, i := range group {
+			vectors[j] = files[i].Embedding
+		}
+
+		if len(group) < dupesMinGraph {
+			var codes []QuantizedVector
+			if quantized {
+				codes = make([]QuantizedVector, len(vectors))
+				for j, vector := range vectors {
+					codes[j] = Quantize(vector)
+				}
+			}
+
+			for a := range group {
+				for b := a + 1; b < len(group); b++ {
+					if len(vectors[a]) != len(vectors[b]) {
+						continue
+					}
+					if quantized && codes[a].Dot(codes[b]) < minSimilarity-quantizedMargin {
+						continue
+					}
+					if similarity := Dot(vectors[a], vectors[b]); similarity >= minSimilarity {
+						pairs = append(pairs, duplicatePair{group[a], group[b], similarity})
+					}
+				}
+			}
+			continue
+		}
+
+		graph := NewVectorIndex(model)
+		for j, vector := range vectors {
+			graph.insertNormalized(j, -1, vector)
+		}
+		for a, vector := range vectors {
+			for _, match := range graph.search(vector, dupesNeighbors) {
+				if b := match.FileID; b > a && match.Similarity >= minSimilarity {
+					pairs = append(pairs, duplicatePair{group[a], group[b], match.Similarity})
+				}
+			}
+		}
+	}
+
+	return pairs
+}
+
+// shinglePairs links files whose extracted text chunks share at least
+// minOverlap of their word shingles, estimated from MinHash signatures.
+func shinglePairs(files []FileInfo, minOverlap float64) []duplicatePair {
+	var group []int
+	var signatures [][minHashes]uint64
+	for i, file := range files {
+		if len(file.Chunks) == 0 {
+			continue
+		}
+
+		shingles := make(map[uint64]struct{})
+		for _, chunk := range file.Chunks {
+			for _, shingle := range Shingles(chunk.Text) {
+				shingles[shingle] = struct{}{}
+			}
+		}
+		if len(shingles) == 0 {
+			continue
+		}
+
+		group = append(group, i)
+		signatures = append(signatures, minHashSignature(shingles))
+	}
+
+	// Locality-sensitive hashing: signatures are cut into bands, and only
+	// files sharing a whole band are compared
+	rows := lshRows(minOverlap)
+	var pairs []duplicatePair
+	compared := make(map[[2]int]bool)
+	for start := 0; start < minHashes; start += rows {
+		buckets := make(map[uint64][]int)
+		for a, signature := range signatures {
+			band := uint64(start)
+			for _, value := range signature[start : start+rows] {
+				band = mix64(band ^ value)
+			}
+			buckets[band] = append(buckets[band], a)
+		}
+
+		for _, bucket := range buckets {
+			for x, a := range bucket {
+				for _, b := range bucket[x+1:] {
+					if compared[[2]int{a, b}] {
+						continue
+					}
+					compared[[2]int{a, b}] = true
+
+					same := 0
+					for h := range signatures[a] {
+						if signatures[a][h] == signatures[b][h] {
+							same++
+						}
+					}
+					if overlap := float64(same) / minHashes; overlap >= minOverlap {
+						pairs = append(pairs, duplicatePair{group[a], group[b], float32(overlap)})
+					}
+				}
+			}
+		}
+	}
+
+	return pairs
+}
+
+// lshRows returns how many signature entries make up an LSH band: the most,
+// so the fewest unrelated files are compared, for which two files with
+// exactly minOverlap still share a band with a probability of 99%.
+func lshRows(minOverlap float64) int {
+	for rows := minHashes / 8; rows > 1; rows /= 2 {
+		bands := float64(minHashes / rows)
+		if 1-math.Pow(1-math.Pow(minOverlap, float64(rows)), bands) >= 0.99 {
+			return rows
+		}
+	}
+	return 1
+}
+
+// Shingles hashes every run of shingleWords consecutive words in text.
+func Shingles(text string) []uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < shingleWords {
+		return nil
+	}
+
+	shingles := make([]uint64, 0, len(words)-shingleWords+1)
+	for i := 0; i+shingleWords <= len(words); i++ {
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(words[i:i+shingleWords], " ")))
+		shingles = append(shingles, hash.Sum64())
+	}
+	return shingles
+}
+
+// minHashSignature keeps, for each of minHashes hash functions, the smallest
+// hash of any shingle. The share of equal entries in two signatures estimates
+// the Jaccard overlap of the shingle sets.
+func minHashSignature(shingles map[uint64]struct{}) [minHashes]uint64 {
+	var signature [minHashes]uint64
+	for h := range signature {
+		signature[h] = math.MaxUint64
+	}
+
+	for shingle := range shingles {
+		for h := range signature {
+			if value := mix64(shingle ^ (uint64(h+1) * 0x9e3779b97f4a7c15)); value < signature[h] {
+				signature[h] = value
+			}
+		}
+	}
+	return signature
+}
+
+// mix64 is the splitmix64 finaliser, used to derive independent hash functions.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func newDuplicateCluster(files []FileInfo, group []int, kind DuplicateKind, similarity float32) DuplicateCluster {
+	cluster := DuplicateCluster{Kind: kind, Similarity: similarity}
+
+	for _, i := range group {
+		file := files[i]
+		cluster.Files = append(cluster.Files, DuplicateFile{
+			Path:         filepath.Join(file.Directory, file.Name),
+			Size:         file.Size,
+			ModifiedTime: file.ModifiedTime,
+		})
+		cluster.TotalSize += file.Size
+	}
+
+	sort.Slice(cluster.Files, func(a, b int) bool {
+		if !cluster.Files[a].ModifiedTime.Equal(cluster.Files[b].ModifiedTime) {
+			return cluster.Files[a].ModifiedTime.After(cluster.Files[b].ModifiedTime)
+		}
+		return cluster.Files[a].Path < cluster.Files[b].Path
+	})
+	cluster.Files[0].Keep = true
+	cluster.Reclaimable = cluster.TotalSize - cluster.Files[0].Size
+
+	return cluster
+}
+
+// TotalReclaimable returns the space freed by removing every file that some
+// cluster does not keep. A file in several clusters is counted once, and not
+// at all if any cluster keeps it.
+func TotalReclaimable(clusters []DuplicateCluster) int64 {
+	kept := make(map[string]bool)
+	for _, cluster := range clusters {
+		for _, file := range cluster.Files {
+			if file.Keep {
+				kept[file.Path] = true
+			}
+		}
+	}
+
+	removed := make(map[string]bool)
+	var total int64
+	for _, cluster := range clusters {
+		for _, file := range cluster.Files {
+			if !kept[file.Path] && !removed[file.Path] {
+				removed[file.Path] = true
+				total += file.Size
+			}
+		}
+	}
+	return total
+}
+
+// sortClusters puts the clusters freeing the most space first.
+func sortClusters(clusters []DuplicateCluster) {
+	sort.Slice(clusters, func(a, b int) bool {
+		if clusters[a].Reclaimable != clusters[b].Reclaimable {
+			return clusters[a].Reclaimable > clusters[b].Reclaimable
+		}
+		return clusters[a].Files[0].Path < clusters[b].Files[0].Path
+	})
+}
@@ -35,14 +35,86 @@ func GetConfigDir() (string, error) {
 	return configDir, nil
 }
 
+// FileInfo is an indexed file as the program works with it. It is not the
+// on-disk format: see fileRecord for that.
+//
+// Id identifies the file for as long as it stays indexed: it is assigned when
+// the file is first stored, and kept when the file changes in place or moves
+// with its content unchanged. Zero means not assigned yet.
 type FileInfo struct {
-	Id              int         `json:"id"`
-	Name            string      `json:"name"`
-	Directory       string      `json:"directory"`
-	Description     string      `json:"description"`
-	Size            int64       `json:"size"`
-	ModifiedTime    time.Time   `json:"modifiedTime"`
-	Embedding       []float32   `json:"embedding"`
-	FileUploaded    bool        `json:"fileUploaded"`
-	UploadedFileUrl *genai.File `json:"uploadedFIleUrl"`
+	Id              int
+	Name            string
+	Directory       string
+	Description     string
+	Size            int64
+	ModifiedTime    time.Time
+	ContentHash     string // hex SHA-256 of the file's content, "" until computed
+	PartialHash     string // see PartialContentHash, "" until computed
+	Embedding       []float32
+	EmbeddingModel  string
+	Chunks          []Chunk
+	FileUploaded    bool
+	UploadedFileUrl *genai.File
+	Status          DescriptionStatus
+	StatusReason    string
+
+	// Set for files read without their embeddings, which are in the store
+	embeddingStored bool
+}
+
+// Chunk is an embedded passage of a file's extracted text, kept so search can
+// match details deep inside long documents and show where they are.
+type Chunk struct {
+	Page      int // 1-based PDF page, 0 for other files
+	Offset    int // byte offset within the page, or the file
+	Text      string
+	Embedding []float32
+}
+
+// LegacyEmbeddingModel produced every embedding stored before the model was
+// recorded alongside it.
+const LegacyEmbeddingModel = "text-embedding-004"
+
+// EmbeddedWith returns the name of the model that produced the file's
+// embedding, or "" when the file has none. A file read without its embedding
+// reports the model of the stored one.
+func (f FileInfo) EmbeddedWith() string {
+	if len(f.Embedding) == 0 && !f.embeddingStored {
+		return ""
+	}
+	if f.EmbeddingModel == "" {
+		return LegacyEmbeddingModel
+	}
+	return f.EmbeddingModel
+}
+
+// DescriptionStatus records whether the model produced a usable description
+// for a file, so blocked or failed files can be reported instead of searched.
+type DescriptionStatus string
+
+const (
+	// StatusUnknown is the zero value found in indexes written before statuses were tracked.
+	StatusUnknown DescriptionStatus = ""
+	// StatusOK means the description was generated from the file content.
+	StatusOK DescriptionStatus = "ok"
+	// StatusMetadataOnly means the content prompt was rejected and the description was generated from metadata alone.
+	StatusMetadataOnly DescriptionStatus = "metadata-only"
+	// StatusBlocked means the prompt or response was blocked by safety filters.
+	StatusBlocked DescriptionStatus = "blocked"
+	// StatusEmpty means the model returned no candidates or no text.
+	StatusEmpty DescriptionStatus = "empty"
+	// StatusFailed means the prompt could not be built or the request errored.
+	StatusFailed DescriptionStatus = "failed"
+)
+
+// HasDescription reports whether the file has a description usable for search.
+func (f FileInfo) HasDescription() bool {
+	switch f.Status {
+	case StatusOK, StatusMetadataOnly:
+		return true
+	case StatusUnknown:
+		// Older indexes stored failures as the literal string "nil".
+		return f.Description != "" && f.Description != "nil"
+	}
+	return false
 }
@@ -0,0 +1,203 @@
+package fileinfo
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter restricts a search to files whose metadata matches. Zero-valued
+// fields do not constrain anything.
+type Filter struct {
+	Dirs           []string // files must be inside one of these directories
+	Exts           []string // extensions, with or without the leading dot
+	Types          []string // image, pdf, text, video or other
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time // inclusive
+	ModifiedBefore time.Time // exclusive
+
+	ExcludeDirs  []string // files inside these directories are left out
+	ExcludeExts  []string
+	ExcludeTypes []string
+}
+
+// fileTypes are the values accepted by Filter.Types.
+var fileTypes = []string{"image", "pdf", "text", "video", "other"}
+
+// Match reports whether file satisfies every constraint of the filter.
+func (f Filter) Match(file FileInfo) bool {
+	if len(f.Dirs) > 0 && !inAnyDir(file.Directory, f.Dirs) {
+		return false
+	}
+
+	if len(f.Exts) > 0 {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Name)), ".")
+		if !containsFold(f.Exts, ext, ".") {
+			return false
+		}
+	}
+
+	if len(f.Types) > 0 && !containsFold(f.Types, FileType(file), "") {
+		return false
+	}
+
+	if len(f.ExcludeDirs) > 0 && inAnyDir(file.Directory, f.ExcludeDirs) {
+		return false
+	}
+	if len(f.ExcludeExts) > 0 {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Name)), ".")
+		if containsFold(f.ExcludeExts, ext, ".") {
+			return false
+		}
+	}
+	if len(f.ExcludeTypes) > 0 && containsFold(f.ExcludeTypes, FileType(file), "") {
+		return false
+	}
+
+	if f.MinSize > 0 && file.Size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && file.Size > f.MaxSize {
+		return false
+	}
+
+	if !f.ModifiedAfter.IsZero() && file.ModifiedTime.Before(f.ModifiedAfter) {
+		return false
+	}
+	if !f.ModifiedBefore.IsZero() && !file.ModifiedTime.Before(f.ModifiedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// Validate checks the filter for unknown file types and inverted ranges.
+func (f Filter) Validate() error {
+	for _, types := range [][]string{f.Types, f.ExcludeTypes} {
+		for _, t := range types {
+			if !containsFold(fileTypes, t, "") {
+				return fmt.Errorf("unknown file type %q (want one of %s)", t, strings.Join(fileTypes, ", "))
+			}
+		}
+	}
+	if f.MinSize > 0 && f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minimum size is larger than maximum size")
+	}
+	if !f.ModifiedAfter.IsZero() && !f.ModifiedBefore.IsZero() && !f.ModifiedAfter.Before(f.ModifiedBefore) {
+		return fmt.Errorf("modified-after date is not before modified-before date")
+	}
+	return nil
+}
+
+// FileType classifies a file the same way prompts are chosen during indexing.
+func FileType(file FileInfo) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(file.Name))
+
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return "text"
+	case strings.HasSuffix(mimeType, "/pdf"):
+		return "pdf"
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	}
+	return "other"
+}
+
+// ParseSize parses sizes such as "2048", "500KB", "1.5MB" or "2G".
+// Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"tb", 1 << 40},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+		{"b", 1},
+	}
+
+	value := strings.ToLower(strings.TrimSpace(s))
+	scale := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			scale = unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500KB, 1.5MB, 2GB)", s)
+	}
+	return int64(n * scale), nil
+}
+
+// FormatSize renders a byte count in the units ParseSize accepts.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// ParseDate parses a date given as YYYY, YYYY-MM or YYYY-MM-DD in local time,
+// returning the start of that year, month or day.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY, YYYY-MM or YYYY-MM-DD)", s)
+}
+
+// ExpandDir makes dir absolute, expanding a leading "~" to the home directory.
+func ExpandDir(dir string) (string, error) {
+	if dir == "~" || strings.HasPrefix(dir, "~/") || strings.HasPrefix(dir, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, dir[1:])
+	}
+	return filepath.Abs(dir)
+}
+
+func inAnyDir(directory string, dirs []string) bool {
+	if abs, err := filepath.Abs(directory); err == nil {
+		directory = abs
+	}
+
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, directory)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, item string, trim string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimPrefix(v, trim), item) {
+			return true
+		}
+	}
+	return false
+}
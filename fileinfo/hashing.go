@@ -2,16 +2,17 @@ package fileinfo
 
 import (
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sync"
 )
 
 type HashSet struct {
 	mu    sync.Mutex
 	store map[string]struct{}
+
+	// changed is set by Add and Remove, so an unchanged set is not written
+	// back over hashes stored by another process in the meantime
+	changed bool
 }
 
 func NewHashSet() *HashSet {
@@ -25,6 +26,7 @@ func (hs *HashSet) Add(hashString string) {
 	defer hs.mu.Unlock()
 
 	hs.store[hashString] = struct{}{}
+	hs.changed = true
 }
 
 func (hs *HashSet) Exists(hashString string) bool {
@@ -40,52 +42,54 @@ func (hs *HashSet) Remove(hashString string) {
 	defer hs.mu.Unlock()
 
 	delete(hs.store, hashString)
+	hs.changed = true
 }
 
-func (hs *HashSet) SaveToFile() error {
-	configDir, err := GetConfigDir()
-	if err != nil {
-		return err
+// Save writes the hash set to the index database if it changed since it was
+// loaded or last saved.
+func (hs *HashSet) Save() error {
+	hs.mu.Lock()
+	changed := hs.changed
+	hs.mu.Unlock()
+	if !changed {
+		return nil
 	}
 
-	hashesPath := filepath.Join(configDir, ".gencli-hashes.json")
-	file, err := os.Create(hashesPath)
+	store, err := OpenStore()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer store.Close()
 
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
 
-	encoder := json.NewEncoder(file)
-	return encoder.Encode(hs.store)
-
+	if err := store.SetHashes(hs.store); err != nil {
+		return err
+	}
+	hs.changed = false
+	return nil
 }
 
-func (hs *HashSet) LoadFromFile() error {
-	configDir, err := GetConfigDir()
+// Load reads the hash set from the index database.
+func (hs *HashSet) Load() error {
+	store, err := OpenStore()
 	if err != nil {
 		return err
 	}
+	defer store.Close()
 
-	hashesPath := filepath.Join(configDir, ".gencli-hashes.json")
-
-	file, err := os.Open(hashesPath)
+	hashes, err := store.Hashes()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, it's not an error; it just means no hashes were saved yet.
-			return nil
-		}
 		return err
 	}
-	defer file.Close()
 
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
 
-	decoder := json.NewDecoder(file)
-	return decoder.Decode(&hs.store)
+	hs.store = hashes
+	hs.changed = false
+	return nil
 }
 
 // Generate a unique hash string for a file based on its properties
@@ -0,0 +1,568 @@
+package fileinfo
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+const (
+	hnswM              = 16  // neighbours per node on upper layers
+	hnswM0             = 32  // neighbours per node on the bottom layer
+	hnswEfConstruction = 100 // candidates considered while inserting
+	hnswMinEfSearch    = 64  // candidates considered while searching
+
+	// The graph is rebuilt once this share of its nodes has been deleted.
+	hnswMaxDeletedRatio = 0.25
+
+	// vectorIndexVersion changes whenever saved graphs can no longer be read.
+	// Version 1 keys nodes by file ID instead of by file hash; version 2 keeps
+	// the vectors in their own file.
+	vectorIndexVersion = 2
+
+	vectorIndexFile = ".gencli-vectors.gob"
+	vectorDataFile  = ".gencli-vectors.bin"
+
+	// The vector file starts with the generation of the graph it belongs to.
+	vectorHeaderSize = 8
+)
+
+// VectorIndex is a persisted HNSW graph over the pre-normalised embeddings of
+// indexed files and their chunks, so nearest-neighbour queries do not have to
+// scan every vector. It holds the vectors of a single embedding model and is
+// updated incrementally as files are indexed, changed or removed.
+//
+// Only the links between nodes are saved with the graph. The vectors are
+// saved to a flat file beside it, from which a loaded graph reads the ones a
+// search reaches; Close releases that file.
+type VectorIndex struct {
+	Version    int
+	Model      string
+	Dim        int
+	Entry      int32 // entry point on the top layer, -1 when empty
+	MaxLevel   int
+	Nodes      []VectorNode
+	Deleted    int
+	Generation uint64 // also written at the start of the vector file
+
+	keys map[nodeKey]int32
+	rng  *rand.Rand
+
+	vectorFile *os.File // vectors not read yet, nil once all are in memory
+	readErr    error    // first failed read, returned by Search
+}
+
+// VectorNode is one vector in the graph. FileID is the file's ID; Chunk is
+// the chunk index, or -1 for the file-level vector. Deleted nodes still route
+// searches but are never returned.
+type VectorNode struct {
+	FileID  int
+	Chunk   int
+	Friends [][]int32 // neighbours on each layer the node is part of
+	Deleted bool
+
+	vector []float32 // nil until read from the vector file
+}
+
+// VectorMatch is a node returned by a nearest-neighbour search. Similarity is
+// the cosine similarity to the query.
+type VectorMatch struct {
+	FileID     int
+	Chunk      int
+	Similarity float32
+}
+
+// NewVectorIndex returns an empty graph for vectors of embeddingModel.
+func NewVectorIndex(embeddingModel string) *VectorIndex {
+	return &VectorIndex{
+		Version: vectorIndexVersion,
+		Model:   embeddingModel,
+		Entry:   -1,
+		keys:    make(map[nodeKey]int32),
+		rng:     rand.New(rand.NewSource(1)),
+	}
+}
+
+// nodeKey identifies the vector of a file, or of one of its chunks.
+type nodeKey struct {
+	fileID int
+	chunk  int
+}
+
+// Len returns the number of live vectors in the graph.
+func (vi *VectorIndex) Len() int {
+	return len(vi.Nodes) - vi.Deleted
+}
+
+// Files returns the number of files with live vectors in the graph. Every
+// file has a file-level vector.
+func (vi *VectorIndex) Files() int {
+	files := 0
+	for _, node := range vi.Nodes {
+		if node.Chunk < 0 && !node.Deleted {
+			files++
+		}
+	}
+	return files
+}
+
+// Sync brings the graph in line with files: vectors of files that changed or
+// disappeared are deleted and new ones inserted. Files are matched by ID, and
+// a file changed in place keeps its ID, so its vectors are compared as well.
+// Only embeddings produced by the graph's model are kept; a different
+// embeddingModel starts a new graph. Files without an ID are left out.
+func (vi *VectorIndex) Sync(files []FileInfo, embeddingModel string) *VectorIndex {
+	// Changing the graph needs every vector; one that cannot be read is rebuilt
+	if vi != nil && (vi.Model != embeddingModel || vi.loadVectors() != nil) {
+		vi.Close()
+		vi = nil
+	}
+	if vi == nil {
+		vi = NewVectorIndex(embeddingModel)
+	}
+
+	type wanted struct {
+		key    nodeKey
+		vector []float32
+	}
+	var order []wanted
+
+	for _, file := range files {
+		if file.Id == 0 || !file.HasDescription() || file.EmbeddedWith() != embeddingModel {
+			continue
+		}
+		order = append(order, wanted{nodeKey{file.Id, -1}, file.Embedding})
+		for i, chunk := range file.Chunks {
+			if len(chunk.Embedding) > 0 {
+				order = append(order, wanted{nodeKey{file.Id, i}, chunk.Embedding})
+			}
+		}
+	}
+	desired := make(map[nodeKey][]float32, len(order))
+	for _, w := range order {
+		desired[w.key] = w.vector
+	}
+
+	for key, id := range vi.keys {
+		// Stored vectors are normalised already, as the nodes' are
+		if vector, ok := desired[key]; !ok || !slices.Equal(vi.Nodes[id].vector, vector) {
+			vi.Nodes[id].Deleted = true
+			vi.Deleted++
+			delete(vi.keys, key)
+		}
+	}
+
+	if vi.Deleted > 0 && float64(vi.Deleted) > hnswMaxDeletedRatio*float64(len(vi.Nodes)) {
+		vi = vi.compact()
+	}
+
+	for _, w := range order {
+		if _, exists := vi.keys[w.key]; !exists {
+			vi.Insert(w.key.fileID, w.key.chunk, w.vector)
+		}
+	}
+
+	return vi
+}
+
+// compact rebuilds the graph from its live nodes.
+func (vi *VectorIndex) compact() *VectorIndex {
+	rebuilt := NewVectorIndex(vi.Model)
+	for _, node := range vi.Nodes {
+		if !node.Deleted {
+			rebuilt.insertNormalized(node.FileID, node.Chunk, node.vector)
+		}
+	}
+	return rebuilt
+}
+
+// Insert adds a vector to the graph. Vectors whose dimension differs from the
+// graph's are ignored.
+func (vi *VectorIndex) Insert(fileID int, chunk int, vector []float32) {
+	vi.insertNormalized(fileID, chunk, Normalize(vector))
+}
+
+func (vi *VectorIndex) insertNormalized(fileID int, chunk int, vector []float32) {
+	if len(vector) == 0 {
+		return
+	}
+	if vi.Dim == 0 {
+		vi.Dim = len(vector)
+	}
+	if len(vector) != vi.Dim {
+		return
+	}
+
+	level := int(math.Floor(-math.Log(1-vi.rng.Float64()) / math.Log(hnswM)))
+	id := int32(len(vi.Nodes))
+	vi.Nodes = append(vi.Nodes, VectorNode{
+		FileID:  fileID,
+		Chunk:   chunk,
+		Friends: make([][]int32, level+1),
+		vector:  vector,
+	})
+	vi.keys[nodeKey{fileID, chunk}] = id
+
+	if vi.Entry < 0 {
+		vi.Entry = id
+		vi.MaxLevel = level
+		return
+	}
+
+	entry := vi.Entry
+	for l := vi.MaxLevel; l > level; l-- {
+		entry = vi.greedyClosest(vector, entry, l)
+	}
+
+	entries := []int32{entry}
+	for l := min(level, vi.MaxLevel); l >= 0; l-- {
+		candidates := vi.searchLayer(vector, entries, hnswEfConstruction, l)
+
+		maxFriends := hnswM
+		if l == 0 {
+			maxFriends = hnswM0
+		}
+
+		neighbours := candidates
+		if len(neighbours) > maxFriends {
+			neighbours = neighbours[:maxFriends]
+		}
+		for _, n := range neighbours {
+			vi.Nodes[id].Friends[l] = append(vi.Nodes[id].Friends[l], n.id)
+			vi.link(n.id, id, l, maxFriends)
+		}
+
+		entries = entries[:0]
+		for _, c := range candidates {
+			entries = append(entries, c.id)
+		}
+	}
+
+	if level > vi.MaxLevel {
+		vi.Entry = id
+		vi.MaxLevel = level
+	}
+}
+
+// link adds a back-link from node to friend on layer l, keeping only the
+// closest maxFriends neighbours.
+func (vi *VectorIndex) link(node, friend int32, l int, maxFriends int) {
+	friends := append(vi.Nodes[node].Friends[l], friend)
+	if len(friends) > maxFriends {
+		vector := vi.vector(node)
+		ranked := make([]candidate, len(friends))
+		for i, f := range friends {
+			ranked[i] = candidate{f, Dot(vector, vi.vector(f))}
+		}
+		sort.Slice(ranked, func(a, b int) bool {
+			return ranked[a].similarity > ranked[b].similarity
+		})
+		friends = friends[:maxFriends]
+		for i := range friends {
+			friends[i] = ranked[i].id
+		}
+	}
+	vi.Nodes[node].Friends[l] = friends
+}
+
+// greedyClosest walks layer l from entry towards the node closest to vector.
+func (vi *VectorIndex) greedyClosest(vector []float32, entry int32, l int) int32 {
+	best := entry
+	bestSimilarity := Dot(vector, vi.vector(entry))
+
+	for changed := true; changed; {
+		changed = false
+		friends := vi.Nodes[best].Friends
+		if l >= len(friends) {
+			break
+		}
+		for _, f := range friends[l] {
+			if similarity := Dot(vector, vi.vector(f)); similarity > bestSimilarity {
+				best, bestSimilarity = f, similarity
+				changed = true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of layer l closest to vector, best first.
+func (vi *VectorIndex) searchLayer(vector []float32, entries []int32, ef int, l int) []candidate {
+	visited := make(map[int32]bool)
+	toVisit := &candidateHeap{best: true}
+	found := &candidateHeap{best: false}
+
+	for _, e := range entries {
+		if visited[e] {
+			continue
+		}
+		visited[e] = true
+		c := candidate{e, Dot(vector, vi.vector(e))}
+		heap.Push(toVisit, c)
+		heap.Push(found, c)
+	}
+
+	for toVisit.Len() > 0 {
+		current := heap.Pop(toVisit).(candidate)
+		if found.Len() >= ef && current.similarity < found.items[0].similarity {
+			break
+		}
+
+		friends := vi.Nodes[current.id].Friends
+		if l >= len(friends) {
+			continue
+		}
+		for _, f := range friends[l] {
+			if visited[f] {
+				continue
+			}
+			visited[f] = true
+
+			similarity := Dot(vector, vi.vector(f))
+			if found.Len() < ef || similarity > found.items[0].similarity {
+				heap.Push(toVisit, candidate{f, similarity})
+				heap.Push(found, candidate{f, similarity})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	results := found.items
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].similarity > results[b].similarity
+	})
+	return results
+}
+
+// vector returns the vector of node id, reading it from the vector file the
+// first time. If that fails the error is kept for Search and a zero vector,
+// similar to nothing, stands in.
+func (vi *VectorIndex) vector(id int32) []float32 {
+	node := &vi.Nodes[id]
+	if node.vector != nil {
+		return node.vector
+	}
+
+	if vi.vectorFile == nil {
+		vi.readErr = fmt.Errorf("vector %d of the vector index is missing", id)
+		return make([]float32, vi.Dim)
+	}
+	data := make([]byte, 4*vi.Dim)
+	if _, err := vi.vectorFile.ReadAt(data, vectorHeaderSize+int64(id)*int64(len(data))); err != nil {
+		if vi.readErr == nil {
+			vi.readErr = fmt.Errorf("failed to read the vector index : %w", err)
+		}
+		return make([]float32, vi.Dim)
+	}
+	node.vector = decodeVector(data)
+	return node.vector
+}
+
+// loadVectors reads the vectors not in memory yet in one pass, and closes
+// the vector file.
+func (vi *VectorIndex) loadVectors() error {
+	if vi.vectorFile == nil {
+		return nil
+	}
+
+	size := 4 * vi.Dim
+	data := make([]byte, size*len(vi.Nodes))
+	if _, err := vi.vectorFile.ReadAt(data, vectorHeaderSize); err != nil {
+		return fmt.Errorf("failed to read the vector index : %w", err)
+	}
+	for id := range vi.Nodes {
+		if vi.Nodes[id].vector == nil {
+			vi.Nodes[id].vector = decodeVector(data[id*size : (id+1)*size])
+		}
+	}
+	return vi.Close()
+}
+
+// Close releases the vector file of a loaded graph. The graph can still be
+// searched over the vectors already read.
+func (vi *VectorIndex) Close() error {
+	if vi == nil || vi.vectorFile == nil {
+		return nil
+	}
+	err := vi.vectorFile.Close()
+	vi.vectorFile = nil
+	return err
+}
+
+// Search returns up to k live vectors closest to query, best first. Only
+// the vectors of the nodes visited are read from disk.
+func (vi *VectorIndex) Search(query []float32, k int) ([]VectorMatch, error) {
+	matches := vi.search(query, k)
+	if vi != nil && vi.readErr != nil {
+		return nil, vi.readErr
+	}
+	return matches, nil
+}
+
+func (vi *VectorIndex) search(query []float32, k int) []VectorMatch {
+	if vi == nil || vi.Entry < 0 || len(query) != vi.Dim || k <= 0 {
+		return nil
+	}
+
+	query = Normalize(query)
+
+	entry := vi.Entry
+	for l := vi.MaxLevel; l > 0; l-- {
+		entry = vi.greedyClosest(query, entry, l)
+	}
+
+	// Deleted nodes take up room among the candidates, so look a little wider
+	ef := max(hnswMinEfSearch, k+vi.Deleted*k/max(len(vi.Nodes), 1))
+	candidates := vi.searchLayer(query, []int32{entry}, ef, 0)
+
+	var matches []VectorMatch
+	for _, c := range candidates {
+		node := vi.Nodes[c.id]
+		if node.Deleted {
+			continue
+		}
+		matches = append(matches, VectorMatch{FileID: node.FileID, Chunk: node.Chunk, Similarity: c.similarity})
+		if len(matches) == k {
+			break
+		}
+	}
+	return matches
+}
+
+type candidate struct {
+	id         int32
+	similarity float32
+}
+
+// candidateHeap keeps the most similar candidate on top when best is set,
+// and the least similar otherwise.
+type candidateHeap struct {
+	items []candidate
+	best  bool
+}
+
+func (h candidateHeap) Len() int { return len(h.items) }
+func (h candidateHeap) Less(i, j int) bool {
+	if h.best {
+		return h.items[i].similarity > h.items[j].similarity
+	}
+	return h.items[i].similarity < h.items[j].similarity
+}
+func (h candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x any)   { h.items = append(h.items, x.(candidate)) }
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// SaveToFile writes the graph and, beside it, its vectors. The vector file is
+// written first, and a graph is only loaded with vectors of its generation.
+func (vi *VectorIndex) SaveToFile() error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+	if err := vi.loadVectors(); err != nil {
+		return err
+	}
+
+	vi.Version = vectorIndexVersion
+	vi.Generation = rand.Uint64()
+
+	vectors := make([]byte, vectorHeaderSize, vectorHeaderSize+4*vi.Dim*len(vi.Nodes))
+	binary.LittleEndian.PutUint64(vectors, vi.Generation)
+	for _, node := range vi.Nodes {
+		vectors = append(vectors, encodeVector(node.vector)...)
+	}
+	if err := WriteFileAtomic(filepath.Join(configDir, vectorDataFile), vectors, 0644); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(vi); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filepath.Join(configDir, vectorIndexFile), buf.Bytes(), 0644)
+}
+
+// LoadVectorIndex reads the saved graph and opens its vector file, without
+// reading the vectors. It returns nil without an error if none has been
+// saved yet, and an error if it was saved by an older version or its vector
+// file does not match, in which case indexing builds it again. The graph
+// must be closed.
+func LoadVectorIndex() (*VectorIndex, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(configDir, vectorIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var vi VectorIndex
+	decoder := gob.NewDecoder(file)
+	if err := decoder.Decode(&vi); err != nil {
+		return nil, err
+	}
+	if vi.Version != vectorIndexVersion {
+		return nil, fmt.Errorf("the vector index was saved by an older version of gencli")
+	}
+
+	vi.vectorFile, err = openVectorFile(filepath.Join(configDir, vectorDataFile), vi.Generation, int64(vectorHeaderSize+4*vi.Dim*len(vi.Nodes)))
+	if err != nil {
+		return nil, err
+	}
+
+	vi.keys = make(map[nodeKey]int32, len(vi.Nodes))
+	for id, node := range vi.Nodes {
+		if !node.Deleted {
+			vi.keys[nodeKey{node.FileID, node.Chunk}] = int32(id)
+		}
+	}
+	vi.rng = rand.New(rand.NewSource(int64(len(vi.Nodes)) + 1))
+
+	return &vi, nil
+}
+
+// openVectorFile opens the vector file saved with a graph of the given
+// generation and checks that it holds all of the graph's vectors.
+func openVectorFile(path string, generation uint64, size int64) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the vectors of the vector index : %w", err)
+	}
+
+	header := make([]byte, vectorHeaderSize)
+	info, err := file.Stat()
+	if err == nil {
+		_, err = io.ReadFull(file, header)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read the vectors of the vector index : %w", err)
+	}
+	if binary.LittleEndian.Uint64(header) != generation || info.Size() != size {
+		file.Close()
+		return nil, fmt.Errorf("the vectors of the vector index belong to another version of it")
+	}
+	return file, nil
+}
@@ -0,0 +1,70 @@
+package fileinfo
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestVectorIndexSaveLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	configDir, err := GetConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(4))
+	graph := NewVectorIndex("test-model")
+	for id := 1; id <= 3000; id++ {
+		graph.Insert(id, -1, randomUnitVector(rng, 64))
+	}
+	query := randomUnitVector(rng, 64)
+	want := graph.search(query, 10)
+
+	if err := graph.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadVectorIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	got, err := loaded.Search(query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("loaded graph found %v, want %v", got, want)
+	}
+
+	// Only the vectors of visited nodes are read
+	read := 0
+	for _, node := range loaded.Nodes {
+		if node.vector != nil {
+			read++
+		}
+	}
+	if read == 0 || read > len(loaded.Nodes)/2 {
+		t.Errorf("search read %d of %d vectors", read, len(loaded.Nodes))
+	}
+
+	// A vector file left from another save is refused rather than misread
+	loaded.Close()
+	path := filepath.Join(configDir, vectorDataFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint64(data, graph.Generation+1)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadVectorIndex(); err == nil {
+		t.Error("loaded a graph with the vectors of another generation")
+	}
+}
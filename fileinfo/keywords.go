@@ -0,0 +1,206 @@
+package fileinfo
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// MinKeywordScore is the BM25 score a file needs to count as a keyword match.
+// A term found in most files scores well below it however often it occurs, so
+// only distinctive terms, such as identifiers or unusual names, match.
+const MinKeywordScore = 1.0
+
+// stopwords are left out of the index and of queries. Besides common English
+// words they include words that describe nearly every file or path.
+var stopwords = map[string]bool{
+	"a": true, "about": true, "all": true, "an": true, "and": true, "any": true, "are": true, "as": true,
+	"at": true, "be": true, "by": true, "can": true, "do": true, "for": true, "from": true, "has": true,
+	"have": true, "how": true, "i": true, "in": true, "is": true, "it": true, "its": true, "me": true,
+	"my": true, "of": true, "on": true, "or": true, "our": true, "show": true, "so": true, "some": true,
+	"that": true, "the": true, "their": true, "them": true, "there": true, "these": true, "this": true,
+	"those": true, "to": true, "was": true, "were": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "with": true, "you": true, "your": true,
+	"file": true, "files": true, "document": true, "documents": true, "folder": true, "folders": true,
+	"contains": true, "containing": true, "find": true,
+}
+
+// KeywordIndex is a BM25 inverted index over file names, paths and
+// descriptions. It finds exact identifiers such as invoice numbers or ticket
+// IDs that embedding similarity tends to miss. Documents are keyed by path.
+type KeywordIndex struct {
+	Postings map[string]map[string]int `json:"postings"` // term -> path -> term frequency
+	Lengths  map[string]int            `json:"lengths"`  // path -> document length in terms
+}
+
+// KeywordMatch is a file matched by a keyword search, with its BM25 score.
+type KeywordMatch struct {
+	Path  string
+	Score float64
+}
+
+// BuildKeywordIndex indexes the files that have a description.
+func BuildKeywordIndex(files []FileInfo) *KeywordIndex {
+	ki := &KeywordIndex{
+		Postings: make(map[string]map[string]int),
+		Lengths:  make(map[string]int),
+	}
+
+	for _, file := range files {
+		if !file.HasDescription() {
+			continue
+		}
+		ki.add(filepath.Join(file.Directory, file.Name), file)
+	}
+
+	return ki
+}
+
+func (ki *KeywordIndex) add(path string, file FileInfo) {
+	// The name is counted twice so a match on it outweighs one in the description
+	terms := Tokenize(file.Name)
+	terms = append(terms, Tokenize(file.Name)...)
+	terms = append(terms, Tokenize(file.Directory)...)
+	terms = append(terms, Tokenize(file.Description)...)
+
+	for _, term := range terms {
+		if ki.Postings[term] == nil {
+			ki.Postings[term] = make(map[string]int)
+		}
+		ki.Postings[term][path]++
+	}
+	ki.Lengths[path] = len(terms)
+}
+
+// Search scores every document containing at least one query term and
+// returns those scoring at least MinKeywordScore, best first.
+func (ki *KeywordIndex) Search(query string) []KeywordMatch {
+	if len(ki.Lengths) == 0 {
+		return nil
+	}
+
+	var totalLength int
+	for _, length := range ki.Lengths {
+		totalLength += length
+	}
+	avgLength := float64(totalLength) / float64(len(ki.Lengths))
+	docCount := float64(len(ki.Lengths))
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := ki.Postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + (docCount-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for path, tf := range postings {
+			freq := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(ki.Lengths[path])/avgLength
+			scores[path] += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+		}
+	}
+
+	matches := make([]KeywordMatch, 0, len(scores))
+	for path, score := range scores {
+		if score >= MinKeywordScore {
+			matches = append(matches, KeywordMatch{Path: path, Score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Path < matches[j].Path
+	})
+
+	return matches
+}
+
+// Tokenize lowercases text and splits it into words, leaving out stopwords.
+// Identifiers joined by '-', '_' or '.' such as "INV-2024-001" are kept whole
+// as well as split, so an exact identifier scores higher than its parts
+// appearing separately.
+func Tokenize(text string) []string {
+	var tokens []string
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.'
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "-_.")
+		if word == "" {
+			continue
+		}
+
+		parts := strings.FieldsFunc(word, func(r rune) bool {
+			return r == '-' || r == '_' || r == '.'
+		})
+		if len(parts) > 1 {
+			tokens = append(tokens, word)
+		}
+		for _, part := range parts {
+			if !stopwords[part] {
+				tokens = append(tokens, part)
+			}
+		}
+	}
+
+	return tokens
+}
+
+func (ki *KeywordIndex) SaveToFile() error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(ki)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filepath.Join(configDir, ".gencli-keywords.json"), append(data, '\n'), 0644)
+}
+
+// LoadKeywordIndex reads the saved keyword index. It returns nil without an
+// error if none has been saved yet.
+func LoadKeywordIndex() (*KeywordIndex, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	keywordsPath := filepath.Join(configDir, ".gencli-keywords.json")
+
+	file, err := os.Open(keywordsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var ki KeywordIndex
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&ki); err != nil {
+		return nil, err
+	}
+	return &ki, nil
+}
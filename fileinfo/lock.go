@@ -0,0 +1,86 @@
+package fileinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockFileName is the advisory lock taken on the config directory by commands
+// that rewrite the index. Readers such as search do not take it.
+const lockFileName = ".gencli.lock"
+
+// ErrLocked is returned by LockConfigDir when another gencli process holds
+// the lock.
+var ErrLocked = errors.New("another gencli is indexing")
+
+// ConfigLock is a held lock on the config directory.
+type ConfigLock struct {
+	file *os.File
+}
+
+// LockConfigDir takes the config directory lock for operation, such as
+// "indexing". It does not wait: if another process holds the lock, the error
+// wraps ErrLocked and says which process and since when. The lock is released
+// by Unlock, or by the operating system when the process exits.
+func LockConfigDir(operation string) (*ConfigLock, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(configDir, lockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file : %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, lockedError(path)
+		}
+		return nil, fmt.Errorf("failed to lock %s : %w", path, err)
+	}
+
+	// Who holds the lock, for the message shown to other processes
+	owner := fmt.Sprintf("%d %s %s\n", os.Getpid(), time.Now().Format(time.RFC3339), operation)
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(owner), 0)
+	}
+
+	return &ConfigLock{file: file}, nil
+}
+
+// Unlock releases the lock. It is safe to call on a nil lock.
+func (l *ConfigLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// lockedError describes the process holding the lock at path, as far as the
+// lock file tells.
+func lockedError(path string) error {
+	data, _ := os.ReadFile(path)
+	fields := strings.SplitN(strings.TrimSpace(string(data)), " ", 3)
+	if len(fields) < 3 {
+		return fmt.Errorf("%w; wait for it to finish and try again", ErrLocked)
+	}
+
+	since := fields[1]
+	if started, err := time.Parse(time.RFC3339, fields[1]); err == nil {
+		since = started.Format("15:04:05")
+	}
+	return fmt.Errorf("%w (pid %s, %s since %s); wait for it to finish and try again", ErrLocked, fields[0], fields[2], since)
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package fileinfo
+
+import (
+	"math"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errWouldBlock = windows.ERROR_LOCK_VIOLATION
+
+// The locked byte lies far past the owner line, so other processes can still
+// read who holds the lock.
+const lockOffset = math.MaxInt32
+
+// lockFile takes an exclusive lock on file without waiting.
+func lockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{Offset: lockOffset}
+	return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{Offset: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+}
@@ -0,0 +1,225 @@
+package fileinfo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// schemaKey in the meta bucket holds the schema version of the database as a
+// big-endian uint32. Databases written before it was added are version 0.
+var schemaKey = []byte("schema")
+
+// migration upgrades the database by one schema version, inside a single
+// transaction.
+type migration struct {
+	description string
+	apply       func(tx *bolt.Tx) error
+}
+
+// migrations[i] upgrades a database from schema version i to i+1. New
+// migrations are appended; existing ones must never change.
+var migrations = []migration{
+	{"store files and chunks as schema records, keeping only the URI and expiry of uploads", migrateToRecords},
+	{"replace the per-run file numbers with stable file IDs", migrateToStableIDs},
+}
+
+// SchemaVersion is the schema version of the index database this build
+// reads and writes.
+var SchemaVersion = len(migrations)
+
+// ErrSchemaTooNew is returned when the index database was written by a newer
+// gencli with a schema this build does not know.
+var ErrSchemaTooNew = errors.New("the index was written by a newer version of gencli; please upgrade")
+
+// SchemaStatus describes the index database against this build's schema.
+type SchemaStatus struct {
+	Exists  bool     // whether the database has been created yet
+	Version int      // schema version of the database
+	Pending []string // migrations that would run, in order
+	Imports []string // legacy JSON files that would be imported into a new database
+}
+
+// Outdated reports whether opening the index would change it.
+func (s SchemaStatus) Outdated() bool {
+	return len(s.Pending) > 0 || len(s.Imports) > 0
+}
+
+// CheckSchema reports the schema version of the index database and the
+// migrations it needs, without changing it.
+func CheckSchema() (SchemaStatus, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+
+	path := filepath.Join(configDir, storeFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return SchemaStatus{Version: SchemaVersion, Imports: legacyFiles(configDir)}, nil
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: storeOpenTimeout, ReadOnly: true})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return SchemaStatus{}, ErrStoreBusy
+	} else if err != nil {
+		return SchemaStatus{}, fmt.Errorf("failed to open index database : %w", err)
+	}
+	defer db.Close()
+
+	status := SchemaStatus{Exists: true}
+	initialized := false
+	err = db.View(func(tx *bolt.Tx) error {
+		status.Version = schemaVersion(tx)
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			initialized = meta.Get(initializedKey) != nil
+		}
+		return nil
+	})
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	if !initialized {
+		// A failed import is retried the next time the database is opened
+		status.Version = SchemaVersion
+		status.Imports = legacyFiles(configDir)
+		return status, nil
+	}
+	if status.Version > SchemaVersion {
+		return status, ErrSchemaTooNew
+	}
+
+	for _, m := range migrations[status.Version:] {
+		status.Pending = append(status.Pending, m.description)
+	}
+	return status, nil
+}
+
+// legacyFiles returns the JSON index files in configDir that OpenStore
+// imports into a new database.
+func legacyFiles(configDir string) []string {
+	var found []string
+	for _, name := range []string{legacyIndexFile, legacyHashesFile} {
+		if _, err := os.Stat(filepath.Join(configDir, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// schemaVersion reads the schema version recorded in the database. A new,
+// empty database has no meta bucket and is taken to be current.
+func schemaVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return SchemaVersion
+	}
+	if value := meta.Get(schemaKey); len(value) == 4 {
+		return int(binary.BigEndian.Uint32(value))
+	}
+	return 0
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	return tx.Bucket(metaBucket).Put(schemaKey, binary.BigEndian.AppendUint32(nil, uint32(version)))
+}
+
+// migrate upgrades the database from schema version from to SchemaVersion.
+// A copy of the database is kept first, and each migration commits together
+// with the version it produces, so an interrupted upgrade resumes where it
+// stopped.
+func (s *Store) migrate(configDir string, from int) error {
+	backup := filepath.Join(configDir, fmt.Sprintf("%s.v%d.bak", storeFileName, from))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backup, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up the index before upgrading it : %w", err)
+	}
+
+	for version := from; version < SchemaVersion; version++ {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			if err := migrations[version].apply(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, version+1)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upgrade the index to schema %d : %w", version+1, err)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, Yellow(fmt.Sprintf("Upgraded the index from schema %d to %d; the previous database was kept as %s", from, SchemaVersion, filepath.Base(backup))))
+	return nil
+}
+
+// migrateToRecords rewrites the FileInfo and Chunk JSON of schema 0 as
+// fileRecord and chunkRecord values.
+func migrateToRecords(tx *bolt.Tx) error {
+	err := rewriteBucket(tx.Bucket(filesBucket), func(key, value []byte) ([]byte, error) {
+		var legacy legacyFile
+		if err := json.Unmarshal(value, &legacy); err != nil {
+			return nil, fmt.Errorf("corrupt index entry for %s : %w", key, err)
+		}
+		return json.Marshal(newFileRecord(legacy.fileInfo()))
+	})
+	if err != nil {
+		return err
+	}
+
+	return rewriteBucket(tx.Bucket(chunksBucket), func(key, value []byte) ([]byte, error) {
+		var legacy legacyChunk
+		if err := json.Unmarshal(value, &legacy); err != nil {
+			return nil, fmt.Errorf("corrupt chunk %q : %w", key, err)
+		}
+		return json.Marshal(newChunkRecord(Chunk(legacy)))
+	})
+}
+
+// rewriteBucket replaces every value in bucket with convert's result. Values
+// are collected first, since a bucket must not change while it is iterated.
+func rewriteBucket(bucket *bolt.Bucket, convert func(key, value []byte) ([]byte, error)) error {
+	var keys, values [][]byte
+	err := bucket.ForEach(func(key, value []byte) error {
+		converted, err := convert(key, value)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, append([]byte(nil), key...))
+		values = append(values, converted)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		if err := bucket.Put(key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateToStableIDs numbers the indexed files from the files bucket's
+// sequence, which assigns the IDs of files indexed from then on. The numbers
+// stored before were reassigned on every run and could collide.
+func migrateToStableIDs(tx *bolt.Tx) error {
+	bucket := tx.Bucket(filesBucket)
+	return rewriteBucket(bucket, func(key, value []byte) ([]byte, error) {
+		var record fileRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, fmt.Errorf("corrupt index entry for %s : %w", key, err)
+		}
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return nil, err
+		}
+		record.ID = int(id)
+		return json.Marshal(record)
+	})
+}
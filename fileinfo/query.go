@@ -0,0 +1,300 @@
+package fileinfo
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Query is a search query split into its parts. Text is the free text that is
+// ranked semantically; Phrases must and Excluded must not appear in a file's
+// name, path, description or extracted text.
+type Query struct {
+	Text     string
+	Filter   Filter
+	Phrases  []string
+	Excluded []string
+}
+
+// queryOperators are the field operators ParseQuery understands.
+var queryOperators = []string{"type", "ext", "dir", "after", "before", "size"}
+
+// ParseQuery parses queries such as
+//
+//	invoice type:pdf dir:~/finance after:2024-01 size:>1MB -draft "exact phrase"
+//
+// Operators may repeat, and type, ext and dir also take comma-separated
+// lists and can be negated, as in -type:video or -dir:~/tmp. Words with an
+// unknown operator prefix, like "re:invoice", are kept as text.
+func ParseQuery(input string) (Query, error) {
+	var query Query
+
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return query, err
+	}
+
+	var text []string
+	for _, token := range tokens {
+		if token.quoted && !token.negated {
+			if token.text != "" {
+				query.Phrases = append(query.Phrases, token.text)
+				text = append(text, token.text)
+			}
+			continue
+		}
+
+		key, value, isOperator := strings.Cut(token.text, ":")
+		if token.quoted || !isOperator || !containsFold(queryOperators, key, "") {
+			if !token.negated {
+				text = append(text, token.text)
+			} else if token.text != "" {
+				query.Excluded = append(query.Excluded, token.text)
+			}
+			continue
+		}
+		if value == "" {
+			return query, fmt.Errorf("operator %s: needs a value, e.g. %s", key, operatorExample(key))
+		}
+		if err := query.applyOperator(strings.ToLower(key), value, token.negated); err != nil {
+			return query, err
+		}
+	}
+
+	query.Text = strings.Join(text, " ")
+	if err := query.Filter.Validate(); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// applyOperator adds one operator to the query's filter. A negated type, ext
+// or dir excludes its values; the ranges have no useful negation, so
+// -after, -before and -size are refused with the operator to use instead.
+func (q *Query) applyOperator(key, value string, negated bool) error {
+	switch key {
+	case "type":
+		types := &q.Filter.Types
+		if negated {
+			types = &q.Filter.ExcludeTypes
+		}
+		for _, t := range splitList(value) {
+			if !containsFold(fileTypes, t, "") {
+				return fmt.Errorf("type:%s : unknown file type (want one of %s, or ext:%s for an extension)", t, strings.Join(fileTypes, ", "), t)
+			}
+			*types = append(*types, t)
+		}
+
+	case "ext":
+		if negated {
+			q.Filter.ExcludeExts = append(q.Filter.ExcludeExts, splitList(value)...)
+		} else {
+			q.Filter.Exts = append(q.Filter.Exts, splitList(value)...)
+		}
+
+	case "dir":
+		dirs := &q.Filter.Dirs
+		if negated {
+			dirs = &q.Filter.ExcludeDirs
+		}
+		for _, dir := range splitList(value) {
+			expanded, err := ExpandDir(dir)
+			if err != nil {
+				return fmt.Errorf("dir:%s : %w", dir, err)
+			}
+			*dirs = append(*dirs, expanded)
+		}
+
+	case "after", "before":
+		if negated {
+			opposite := "before"
+			if key == "before" {
+				opposite = "after"
+			}
+			return fmt.Errorf("-%s:%s : dates cannot be negated, use %s:%s instead", key, value, opposite, value)
+		}
+		date, err := ParseDate(value)
+		if err != nil {
+			return fmt.Errorf("%s:%s : %w", key, value, err)
+		}
+		if key == "after" {
+			q.Filter.ModifiedAfter = date
+		} else {
+			q.Filter.ModifiedBefore = date
+		}
+
+	case "size":
+		if negated {
+			for _, op := range [][2]string{{">=", "<"}, {"<=", ">"}, {">", "<="}, {"<", ">="}} {
+				if n, ok := strings.CutPrefix(value, op[0]); ok {
+					return fmt.Errorf("-size:%s : sizes cannot be negated, use size:%s%s instead", value, op[1], n)
+				}
+			}
+			return fmt.Errorf("-size:%s : sizes cannot be negated, use size:> or size:< instead", value)
+		}
+		if err := q.applySize(value); err != nil {
+			return fmt.Errorf("size:%s : %w", value, err)
+		}
+	}
+
+	return nil
+}
+
+// applySize understands >N, >=N, <N, <=N and the inclusive range N..M.
+func (q *Query) applySize(value string) error {
+	if low, high, isRange := strings.Cut(value, ".."); isRange {
+		lowSize, err := ParseSize(low)
+		if err != nil {
+			return err
+		}
+		highSize, err := ParseSize(high)
+		if err != nil {
+			return err
+		}
+		q.Filter.MinSize, q.Filter.MaxSize = lowSize, highSize
+		return nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(value, op) {
+			continue
+		}
+		n, err := ParseSize(strings.TrimPrefix(value, op))
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case ">=":
+			q.Filter.MinSize = n
+		case ">":
+			q.Filter.MinSize = n + 1
+		case "<=":
+			q.Filter.MaxSize = n
+		case "<":
+			if n == 0 {
+				return fmt.Errorf("no file is smaller than 0 bytes")
+			}
+			q.Filter.MaxSize = n - 1
+		}
+		return nil
+	}
+
+	return fmt.Errorf("size needs a comparison or a range, e.g. size:>1MB or size:1MB..5MB")
+}
+
+// Match reports whether file passes the query's filters, contains every
+// phrase and none of the excluded terms.
+func (q Query) Match(file FileInfo) bool {
+	if !q.Filter.Match(file) {
+		return false
+	}
+	if len(q.Phrases) == 0 && len(q.Excluded) == 0 {
+		return true
+	}
+
+	content := searchableText(file)
+	for _, phrase := range q.Phrases {
+		if !strings.Contains(content, strings.ToLower(phrase)) {
+			return false
+		}
+	}
+	for _, term := range q.Excluded {
+		if strings.Contains(content, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchableText is the lowercased text phrases are looked for in.
+func searchableText(file FileInfo) string {
+	var builder strings.Builder
+	builder.WriteString(filepath.Join(file.Directory, file.Name))
+	builder.WriteString("\n")
+	builder.WriteString(file.Description)
+	for _, chunk := range file.Chunks {
+		builder.WriteString("\n")
+		builder.WriteString(chunk.Text)
+	}
+	return strings.ToLower(strings.Join(strings.Fields(builder.String()), " "))
+}
+
+type queryToken struct {
+	text    string
+	quoted  bool // the whole token was a quoted phrase
+	negated bool // the token was prefixed with '-'
+}
+
+// lexQuery splits input on whitespace. A token may start with '-' to negate
+// it, and double quotes keep spaces together, either around a whole phrase or
+// inside an operator value such as dir:"~/My Files".
+func lexQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var token queryToken
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			token.negated = true
+			i++
+		}
+		token.quoted = runes[i] == '"'
+
+		var text strings.Builder
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if runes[i] != '"' {
+				text.WriteRune(runes[i])
+				i++
+				continue
+			}
+
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote in query")
+			}
+			text.WriteString(string(runes[i+1 : end]))
+			i = end + 1
+		}
+
+		token.text = strings.TrimSpace(text.String())
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func operatorExample(key string) string {
+	switch strings.ToLower(key) {
+	case "type":
+		return "type:pdf"
+	case "ext":
+		return "ext:xlsx"
+	case "dir":
+		return "dir:~/finance"
+	case "after":
+		return "after:2024-01"
+	case "before":
+		return "before:2024-06-30"
+	}
+	return "size:>1MB"
+}
@@ -0,0 +1,136 @@
+package fileinfo
+
+import (
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// fileRecord is a file as stored in the index database. It is kept apart
+// from FileInfo so the in-memory struct can change without changing what is
+// on disk. Optional fields can be added freely; any other change to this
+// type needs a new schema version and a migration. Embeddings and chunks are
+// stored under their own keys.
+type fileRecord struct {
+	ID             int               `json:"id"`
+	Name           string            `json:"name"`
+	Directory      string            `json:"directory"`
+	Description    string            `json:"description"`
+	Size           int64             `json:"size"`
+	ModifiedTime   time.Time         `json:"modifiedTime"`
+	ContentHash    string            `json:"contentHash,omitempty"`
+	PartialHash    string            `json:"partialHash,omitempty"`
+	EmbeddingModel string            `json:"embeddingModel,omitempty"`
+	Status         DescriptionStatus `json:"status,omitempty"`
+	StatusReason   string            `json:"statusReason,omitempty"`
+
+	// The Gemini upload of an image or video, reused until it expires
+	UploadURI     string    `json:"uploadUri,omitempty"`
+	UploadExpires time.Time `json:"uploadExpires,omitempty"`
+}
+
+// chunkRecord is a chunk as stored in the index database, without its
+// embedding.
+type chunkRecord struct {
+	Page   int    `json:"page,omitempty"`
+	Offset int    `json:"offset"`
+	Text   string `json:"text"`
+}
+
+func newFileRecord(file FileInfo) fileRecord {
+	record := fileRecord{
+		ID:             file.Id,
+		Name:           file.Name,
+		Directory:      file.Directory,
+		Description:    file.Description,
+		Size:           file.Size,
+		ModifiedTime:   file.ModifiedTime,
+		ContentHash:    file.ContentHash,
+		PartialHash:    file.PartialHash,
+		EmbeddingModel: file.EmbeddingModel,
+		Status:         file.Status,
+		StatusReason:   file.StatusReason,
+	}
+	if file.FileUploaded && file.UploadedFileUrl != nil {
+		record.UploadURI = file.UploadedFileUrl.URI
+		record.UploadExpires = file.UploadedFileUrl.ExpirationTime
+	}
+	return record
+}
+
+// fileInfo returns the record as a FileInfo, without embedding or chunks. An
+// expired upload is dropped, so the file is uploaded again if needed.
+func (r fileRecord) fileInfo() FileInfo {
+	file := FileInfo{
+		Id:             r.ID,
+		Name:           r.Name,
+		Directory:      r.Directory,
+		Description:    r.Description,
+		Size:           r.Size,
+		ModifiedTime:   r.ModifiedTime,
+		ContentHash:    r.ContentHash,
+		PartialHash:    r.PartialHash,
+		EmbeddingModel: r.EmbeddingModel,
+		Status:         r.Status,
+		StatusReason:   r.StatusReason,
+	}
+	if r.UploadURI != "" && (r.UploadExpires.IsZero() || time.Now().Before(r.UploadExpires)) {
+		file.FileUploaded = true
+		file.UploadedFileUrl = &genai.File{URI: r.UploadURI, ExpirationTime: r.UploadExpires}
+	}
+	return file
+}
+
+func newChunkRecord(chunk Chunk) chunkRecord {
+	return chunkRecord{Page: chunk.Page, Offset: chunk.Offset, Text: chunk.Text}
+}
+
+func (r chunkRecord) chunk() Chunk {
+	return Chunk{Page: r.Page, Offset: r.Offset, Text: r.Text}
+}
+
+// legacyFile is FileInfo as it was serialised before the index had a schema:
+// in the JSON index file, and in databases of schema version 0.
+type legacyFile struct {
+	Id              int               `json:"id"`
+	Name            string            `json:"name"`
+	Directory       string            `json:"directory"`
+	Description     string            `json:"description"`
+	Size            int64             `json:"size"`
+	ModifiedTime    time.Time         `json:"modifiedTime"`
+	Embedding       []float32         `json:"embedding"`
+	EmbeddingModel  string            `json:"embeddingModel,omitempty"`
+	Chunks          []legacyChunk     `json:"chunks,omitempty"`
+	FileUploaded    bool              `json:"fileUploaded"`
+	UploadedFileUrl *genai.File       `json:"uploadedFIleUrl"`
+	Status          DescriptionStatus `json:"status,omitempty"`
+	StatusReason    string            `json:"statusReason,omitempty"`
+}
+
+type legacyChunk struct {
+	Page      int       `json:"page,omitempty"`
+	Offset    int       `json:"offset"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func (l legacyFile) fileInfo() FileInfo {
+	file := FileInfo{
+		Id:              l.Id,
+		Name:            l.Name,
+		Directory:       l.Directory,
+		Description:     l.Description,
+		Size:            l.Size,
+		ModifiedTime:    l.ModifiedTime,
+		Embedding:       l.Embedding,
+		EmbeddingModel:  l.EmbeddingModel,
+		FileUploaded:    l.FileUploaded,
+		UploadedFileUrl: l.UploadedFileUrl,
+		Status:          l.Status,
+		StatusReason:    l.StatusReason,
+	}
+	for _, chunk := range l.Chunks {
+		file.Chunks = append(file.Chunks, Chunk(chunk))
+	}
+	return file
+}
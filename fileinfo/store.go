@@ -0,0 +1,405 @@
+package fileinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The index database lives in the config directory. Files are keyed by their
+// path; a chunk's key is its file's path, a NUL byte and the chunk number, so
+// a file's chunks can be found, and deleted, by prefix.
+const (
+	storeFileName = ".gencli-index.db"
+
+	// Index files written before the database, imported once and kept as backups
+	legacyIndexFile  = ".gencli-index.json"
+	legacyHashesFile = ".gencli-hashes.json"
+
+	// How long to wait for another gencli process holding the database
+	storeOpenTimeout = 5 * time.Second
+)
+
+var (
+	filesBucket      = []byte("files")      // path -> file metadata and description, as JSON
+	embeddingsBucket = []byte("embeddings") // path -> description embedding; chunk key -> chunk embedding
+	chunksBucket     = []byte("chunks")     // chunk key -> page, offset and text, as JSON
+	hashesBucket     = []byte("hashes")     // file hash -> nothing
+	metaBucket       = []byte("meta")       // initializedKey, schemaKey
+)
+
+var storeBuckets = [][]byte{filesBucket, embeddingsBucket, chunksBucket, hashesBucket, metaBucket}
+
+// initializedKey in the meta bucket records when the database was set up.
+var initializedKey = []byte("initialized")
+
+// ErrStoreBusy is returned when another gencli process keeps the index
+// database open for longer than storeOpenTimeout.
+var ErrStoreBusy = errors.New("the index is in use by another gencli process; try again when it has finished")
+
+// Store is the embedded database holding the index: the indexed files, their
+// embeddings and text chunks, and the hash set of seen files. Only one
+// process can have it open, so it should be closed as soon as possible.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens the index database, creating it on first use. An index
+// kept in the older JSON files is imported into a new database, and the JSON
+// files are renamed with a .bak suffix. A database of an older schema is
+// upgraded.
+func OpenStore() (*Store, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(configDir, storeFileName), 0644, &bolt.Options{Timeout: storeOpenTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrStoreBusy
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open index database : %w", err)
+	}
+	store := &Store{db: db}
+
+	initialized := false
+	version := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range storeBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		initialized = tx.Bucket(metaBucket).Get(initializedKey) != nil
+		version = schemaVersion(tx)
+		return nil
+	})
+
+	if err == nil {
+		switch {
+		case !initialized:
+			// Marked only once the import succeeded, so a failed one is retried
+			err = store.importLegacy(configDir)
+			if err == nil {
+				err = db.Update(func(tx *bolt.Tx) error {
+					if err := setSchemaVersion(tx, SchemaVersion); err != nil {
+						return err
+					}
+					return tx.Bucket(metaBucket).Put(initializedKey, []byte(time.Now().Format(time.RFC3339)))
+				})
+			}
+		case version > SchemaVersion:
+			err = ErrSchemaTooNew
+		case version < SchemaVersion:
+			err = store.migrate(configDir, version)
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close releases the database for other processes.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Files returns every indexed file with its embedding and chunks.
+func (s *Store) Files() ([]FileInfo, error) {
+	return s.files(true)
+}
+
+// FileMetadata returns every indexed file without its embedding and chunks,
+// which are most of the index and not needed to filter files. LoadEmbeddings
+// fills them in for the files that need them; until then a file cannot be
+// stored again.
+func (s *Store) FileMetadata() ([]FileInfo, error) {
+	return s.files(false)
+}
+
+func (s *Store) files(withEmbeddings bool) ([]FileInfo, error) {
+	var files []FileInfo
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		embeddings := tx.Bucket(embeddingsBucket)
+
+		return tx.Bucket(filesBucket).ForEach(func(key, value []byte) error {
+			var record fileRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("corrupt index entry for %s : %w", key, err)
+			}
+			file := record.fileInfo()
+
+			if withEmbeddings {
+				if err := loadEmbeddings(tx, &file); err != nil {
+					return err
+				}
+			} else {
+				file.embeddingStored = embeddings.Get(key) != nil
+			}
+
+			files = append(files, file)
+			return nil
+		})
+	})
+
+	return files, err
+}
+
+// LoadEmbeddings reads the embedding and chunks of each of files.
+func (s *Store) LoadEmbeddings(files []*FileInfo) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		for _, file := range files {
+			if err := loadEmbeddings(tx, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func loadEmbeddings(tx *bolt.Tx, file *FileInfo) error {
+	path := filepath.Join(file.Directory, file.Name)
+	embeddings := tx.Bucket(embeddingsBucket)
+
+	file.Embedding = decodeVector(embeddings.Get([]byte(path)))
+	file.Chunks = nil
+	file.embeddingStored = false
+
+	prefix := chunkPrefix(path)
+	chunks := tx.Bucket(chunksBucket).Cursor()
+	for k, v := chunks.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = chunks.Next() {
+		var record chunkRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("corrupt chunk of %s : %w", path, err)
+		}
+		chunk := record.chunk()
+		chunk.Embedding = decodeVector(embeddings.Get(k))
+		file.Chunks = append(file.Chunks, chunk)
+	}
+	return nil
+}
+
+// Update adds or replaces files and removes the files at the paths in
+// deleted, in a single transaction.
+func (s *Store) Update(files []FileInfo, deleted []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, path := range deleted {
+			if err := deleteFile(tx, path); err != nil {
+				return err
+			}
+		}
+		for _, file := range files {
+			if err := putFile(tx, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Hashes returns the stored hash set.
+func (s *Store) Hashes() (map[string]struct{}, error) {
+	hashes := make(map[string]struct{})
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(hashesBucket).ForEach(func(key, _ []byte) error {
+			hashes[string(key)] = struct{}{}
+			return nil
+		})
+	})
+	return hashes, err
+}
+
+// SetHashes replaces the stored hash set.
+func (s *Store) SetHashes(hashes map[string]struct{}) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(hashesBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(hashesBucket)
+		if err != nil {
+			return err
+		}
+		for hash := range hashes {
+			if err := bucket.Put([]byte(hash), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// putFile stores file, assigning it the next file ID if it has none.
+func putFile(tx *bolt.Tx, file FileInfo) error {
+	path := filepath.Join(file.Directory, file.Name)
+	if file.embeddingStored {
+		return fmt.Errorf("cannot store %s : it was read without its embeddings", path)
+	}
+
+	if file.Id == 0 {
+		id, err := tx.Bucket(filesBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		file.Id = int(id)
+	}
+
+	// A changed file may have fewer chunks than before
+	if err := deleteFile(tx, path); err != nil {
+		return err
+	}
+
+	embedding, chunks := file.Embedding, file.Chunks
+	record, err := json.Marshal(newFileRecord(file))
+	if err != nil {
+		return err
+	}
+
+	key := []byte(path)
+	if err := tx.Bucket(filesBucket).Put(key, record); err != nil {
+		return err
+	}
+	if len(embedding) > 0 {
+		if err := tx.Bucket(embeddingsBucket).Put(key, encodeVector(embedding)); err != nil {
+			return err
+		}
+	}
+
+	for i, chunk := range chunks {
+		chunkKey := append(chunkPrefix(path), binary.BigEndian.AppendUint32(nil, uint32(i))...)
+
+		value, err := json.Marshal(newChunkRecord(chunk))
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(chunksBucket).Put(chunkKey, value); err != nil {
+			return err
+		}
+		if len(chunk.Embedding) > 0 {
+			if err := tx.Bucket(embeddingsBucket).Put(chunkKey, encodeVector(chunk.Embedding)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func deleteFile(tx *bolt.Tx, path string) error {
+	key := []byte(path)
+	if err := tx.Bucket(filesBucket).Delete(key); err != nil {
+		return err
+	}
+
+	embeddings := tx.Bucket(embeddingsBucket)
+	if err := embeddings.Delete(key); err != nil {
+		return err
+	}
+
+	// Keys are collected first, since deleting moves the cursor
+	prefix := chunkPrefix(path)
+	var chunkKeys [][]byte
+	cursor := tx.Bucket(chunksBucket).Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		chunkKeys = append(chunkKeys, append([]byte(nil), k...))
+	}
+	for _, k := range chunkKeys {
+		if err := tx.Bucket(chunksBucket).Delete(k); err != nil {
+			return err
+		}
+		if err := embeddings.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLegacy copies the JSON index and hash set into the new database.
+func (s *Store) importLegacy(configDir string) error {
+	indexPath := filepath.Join(configDir, legacyIndexFile)
+	hashesPath := filepath.Join(configDir, legacyHashesFile)
+
+	var files []FileInfo
+	if data, err := os.ReadFile(indexPath); err == nil {
+		var legacy []legacyFile
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("failed to import %s : %w", legacyIndexFile, err)
+		}
+		for _, file := range legacy {
+			// The old numbers were per run, so new IDs are assigned
+			file.Id = 0
+			files = append(files, file.fileInfo())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	hashes := make(map[string]struct{})
+	if data, err := os.ReadFile(hashesPath); err == nil {
+		if err := json.Unmarshal(data, &hashes); err != nil {
+			return fmt.Errorf("failed to import %s : %w", legacyHashesFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(files) == 0 && len(hashes) == 0 {
+		return nil
+	}
+
+	for i := range files {
+		files[i].NormalizeEmbeddings()
+	}
+	if err := s.Update(files, nil); err != nil {
+		return fmt.Errorf("failed to import index : %w", err)
+	}
+	if err := s.SetHashes(hashes); err != nil {
+		return fmt.Errorf("failed to import hash set : %w", err)
+	}
+
+	for _, path := range []string{indexPath, hashesPath} {
+		if _, err := os.Stat(path); err == nil {
+			if err := os.Rename(path, path+".bak"); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintln(os.Stderr, Yellow(fmt.Sprintf("Moved %d indexed files into %s; the old JSON files were kept with a .bak suffix", len(files), storeFileName)))
+	return nil
+}
+
+func chunkPrefix(path string) []byte {
+	return append([]byte(path), 0)
+}
+
+// encodeVector stores a vector as little-endian float32 values, a quarter
+// of the size of its JSON form.
+func encodeVector(v []float32) []byte {
+	data := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(x))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	if len(data) == 0 {
+		return nil
+	}
+	v := make([]float32, len(data)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return v
+}
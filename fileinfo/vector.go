@@ -0,0 +1,119 @@
+package fileinfo
+
+import "math"
+
+// Embeddings are stored at unit length, so comparing two of them is a single
+// dot product. This tolerance absorbs the rounding of the JSON round-trip.
+const normTolerance = 1e-3
+
+// Normalize returns a copy of v scaled to unit length, so the dot product of
+// two normalised vectors is their cosine similarity. A zero vector stays zero.
+func Normalize(v []float32) []float32 {
+	normalized := make([]float32, len(v))
+	copy(normalized, v)
+	normalizeInPlace(normalized)
+	return normalized
+}
+
+func normalizeInPlace(v []float32) {
+	norm := Dot(v, v)
+	if norm == 0 || math.Abs(float64(norm)-1) < normTolerance {
+		return
+	}
+
+	scale := float32(1 / math.Sqrt(float64(norm)))
+	for i := range v {
+		v[i] *= scale
+	}
+}
+
+// NormalizeEmbeddings scales the file's description and chunk embeddings to
+// unit length in place. It is done once when files are embedded, and again
+// for indexes written before embeddings were stored normalised.
+func (f *FileInfo) NormalizeEmbeddings() {
+	normalizeInPlace(f.Embedding)
+	for i := range f.Chunks {
+		normalizeInPlace(f.Chunks[i].Embedding)
+	}
+}
+
+// Similarity returns the cosine similarity of two normalised vectors. It
+// reports false instead of a score when either vector is missing or their
+// dimensions differ, as happens for files whose embedding call failed or that
+// were embedded by another model.
+func Similarity(a, b []float32) (float32, bool) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, false
+	}
+	return Dot(a, b), true
+}
+
+// Dot returns the dot product of two vectors of equal length. The loop is
+// unrolled with independent accumulators so the additions can overlap. b must
+// be at least as long as a, or Dot panics; use Similarity for vectors whose
+// dimensions are not known to match.
+func Dot(a, b []float32) float32 {
+	b = b[:len(a)]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		s0 += a[i]*b[i] + a[i+4]*b[i+4]
+		s1 += a[i+1]*b[i+1] + a[i+5]*b[i+5]
+		s2 += a[i+2]*b[i+2] + a[i+6]*b[i+6]
+		s3 += a[i+3]*b[i+3] + a[i+7]*b[i+7]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+// QuantizedVector is a normalised vector stored as int8 values with a shared
+// scale. It takes a quarter of the memory and scores within about 0.01 of
+// the float32 vector, which is enough to discard clear non-matches cheaply.
+type QuantizedVector struct {
+	Values []int8
+	Scale  float32
+}
+
+// Quantize maps each value of v onto -127..127, scaled by its largest
+// magnitude. -128 is never used, which QuantizedVector.Dot relies on.
+func Quantize(v []float32) QuantizedVector {
+	var largest float32
+	for _, x := range v {
+		largest = max(largest, x, -x)
+	}
+
+	q := QuantizedVector{Values: make([]int8, len(v))}
+	if largest == 0 {
+		return q
+	}
+
+	q.Scale = largest / 127
+	for i, x := range v {
+		q.Values[i] = int8(math.Round(float64(x / q.Scale)))
+	}
+	return q
+}
+
+// Dot returns the approximate dot product of two quantized vectors of equal
+// length. other must be at least as long as q, or Dot panics.
+func (q QuantizedVector) Dot(other QuantizedVector) float32 {
+	a, b := q.Values, other.Values[:len(q.Values)]
+
+	// Two int8 products always fit in an int16, so pairs are added before
+	// widening to the accumulators.
+	var s0, s1, s2, s3 int32
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		s0 += int32(int16(a[i])*int16(b[i]) + int16(a[i+4])*int16(b[i+4]))
+		s1 += int32(int16(a[i+1])*int16(b[i+1]) + int16(a[i+5])*int16(b[i+5]))
+		s2 += int32(int16(a[i+2])*int16(b[i+2]) + int16(a[i+6])*int16(b[i+6]))
+		s3 += int32(int16(a[i+3])*int16(b[i+3]) + int16(a[i+7])*int16(b[i+7]))
+	}
+	for ; i < len(a); i++ {
+		s0 += int32(a[i]) * int32(b[i])
+	}
+	return float32(s0+s1+s2+s3) * q.Scale * other.Scale
+}
@@ -0,0 +1,154 @@
+package fileinfo
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// benchVectors and benchDimensions match a large index embedded with
+// text-embedding-004.
+const (
+	benchVectors    = 100_000
+	benchDimensions = 768
+)
+
+// randomUnitVector returns a normalised vector with normally distributed
+// components, which is how embedding values are spread.
+func randomUnitVector(rng *rand.Rand, dimensions int) []float32 {
+	v := make([]float32, dimensions)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	return Normalize(v)
+}
+
+var benchData = sync.OnceValues(func() ([][]float32, []QuantizedVector) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := make([][]float32, benchVectors)
+	codes := make([]QuantizedVector, benchVectors)
+	for i := range vectors {
+		vectors[i] = randomUnitVector(rng, benchDimensions)
+		codes[i] = Quantize(vectors[i])
+	}
+	return vectors, codes
+})
+
+// BenchmarkDot scores a query against every vector, as an exhaustive search does.
+func BenchmarkDot(b *testing.B) {
+	vectors, _ := benchData()
+	query := randomUnitVector(rand.New(rand.NewSource(2)), benchDimensions)
+	b.ResetTimer()
+
+	var sink float32
+	for n := 0; n < b.N; n++ {
+		for _, v := range vectors {
+			sink += Dot(query, v)
+		}
+	}
+	_ = sink
+}
+
+// BenchmarkQuantizedDot is BenchmarkDot over the int8 vectors.
+func BenchmarkQuantizedDot(b *testing.B) {
+	_, codes := benchData()
+	query := Quantize(randomUnitVector(rand.New(rand.NewSource(2)), benchDimensions))
+	b.ResetTimer()
+
+	var sink float32
+	for n := 0; n < b.N; n++ {
+		for _, c := range codes {
+			sink += query.Dot(c)
+		}
+	}
+	_ = sink
+}
+
+func TestSimilarity(t *testing.T) {
+	unit := Normalize([]float32{1, 2, 3, 4})
+
+	tests := []struct {
+		name  string
+		a, b  []float32
+		want  float32
+		valid bool
+	}{
+		{"both nil", nil, nil, 0, false},
+		{"first nil", nil, unit, 0, false},
+		{"second nil", unit, nil, 0, false},
+		{"empty", []float32{}, []float32{}, 0, false},
+		{"shorter second", unit, unit[:3], 0, false},
+		{"longer second", unit[:3], unit, 0, false},
+		{"zero vector", []float32{0, 0, 0, 0}, unit, 0, true},
+		{"same vector", unit, unit, 1, true},
+		{"opposite vectors", []float32{1, 0}, []float32{-1, 0}, -1, true},
+		{"orthogonal vectors", []float32{1, 0}, []float32{0, 1}, 0, true},
+		{"odd dimensions past the unrolled loop", Normalize([]float32{1, 1, 1, 1, 1, 1, 1, 1, 1}), Normalize([]float32{1, 1, 1, 1, 1, 1, 1, 1, 1}), 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, valid := Similarity(test.a, test.b)
+			if valid != test.valid {
+				t.Fatalf("Similarity valid = %v, want %v", valid, test.valid)
+			}
+			if math.Abs(float64(got-test.want)) > 1e-6 {
+				t.Errorf("Similarity = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuantizeErrorBound(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	spike := make([]float32, benchDimensions)
+	spike[7] = 1
+	alternating := make([]float32, benchDimensions)
+	for i := range alternating {
+		alternating[i] = float32(1 - 2*(i%2))
+	}
+
+	tests := []struct {
+		name string
+		a, b []float32
+	}{
+		{"random vectors", randomUnitVector(rng, benchDimensions), randomUnitVector(rng, benchDimensions)},
+		{"same vector", spike, spike},
+		{"one large component", spike, randomUnitVector(rng, benchDimensions)},
+		{"alternating signs", Normalize(alternating), randomUnitVector(rng, benchDimensions)},
+		{"short vectors", randomUnitVector(rng, 5), randomUnitVector(rng, 5)},
+		{"zero vector", make([]float32, benchDimensions), randomUnitVector(rng, benchDimensions)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qa, qb := Quantize(test.a), Quantize(test.b)
+
+			// Rounding moves each value by at most half a step
+			for i, x := range test.a {
+				if diff := math.Abs(float64(x - float32(qa.Values[i])*qa.Scale)); diff > float64(qa.Scale)/2+1e-7 {
+					t.Fatalf("value %d off by %v, more than half of scale %v", i, diff, qa.Scale)
+				}
+			}
+
+			// The dot product can then be off by at most the rounding of each
+			// side weighted by the other, plus the product of both roundings
+			var normA, normB float64
+			for i := range test.a {
+				normA += math.Abs(float64(test.a[i]))
+				normB += math.Abs(float64(test.b[i]))
+			}
+			bound := float64(qa.Scale)/2*normB + float64(qb.Scale)/2*normA + float64(qa.Scale*qb.Scale)/4*float64(len(test.a)) + 1e-6
+
+			diff := math.Abs(float64(Dot(test.a, test.b) - qa.Dot(qb)))
+			if diff > bound {
+				t.Errorf("quantized dot product off by %v, more than the bound %v", diff, bound)
+			}
+			// What QuantizedVector documents for typical embeddings
+			if diff > 0.01 {
+				t.Errorf("quantized dot product off by %v, more than 0.01", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gemini_cli_tool/fileinfo"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	maxSourceBytes  = 16 * 1024 // text of a single file sent with a question
+	maxContextBytes = 96 * 1024 // text of all files sent with a question
+)
+
+// AskSource is an indexed file offered to the model as context for a
+// question. Passage, when set, is the chunk that matched the question and is
+// sent first so it survives truncation.
+type AskSource struct {
+	File    fileinfo.FileInfo
+	Passage *fileinfo.Chunk
+}
+
+// AnswerQuestion streams the model's answer to question, grounded in the
+// extracted text of sources and citing their paths and pages inline. Files
+// without extractable text are represented by their descriptions.
+func AnswerQuestion(question string, sources []AskSource, defaultApiKey string) (*genai.GenerateContentResponseIterator, error) {
+	ctx := context.Background()
+
+	session, err := NewchatSession(ctx, defaultApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	model := session.client.GenerativeModel("gemini-2.5-flash")
+	model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(
+		"Answer the user's question using only the files provided. " +
+			"After every statement drawn from a file, cite it inline as [path, p. N] for PDF pages or [path] otherwise, using the exact path given. " +
+			"If the files do not contain the answer, say so plainly instead of guessing.")}}
+
+	var prompt strings.Builder
+	budget := maxContextBytes
+	for _, source := range sources {
+		if budget <= 0 {
+			break
+		}
+		text := sourceText(source, min(maxSourceBytes, budget))
+		budget -= len(text)
+
+		prompt.WriteString(fmt.Sprintf("=== File: %s ===\n%s\n\n", filepath.Join(source.File.Directory, source.File.Name), text))
+	}
+	prompt.WriteString("Question: " + question)
+
+	return model.GenerateContentStream(ctx, genai.Text(prompt.String())), nil
+}
+
+// sourceText renders the file's text with page markers, cut to limit bytes.
+func sourceText(source AskSource, limit int) string {
+	var builder strings.Builder
+
+	if passage := source.Passage; passage != nil {
+		if passage.Page > 0 {
+			builder.WriteString(fmt.Sprintf("--- matched passage, page %d ---\n", passage.Page))
+		} else {
+			builder.WriteString("--- matched passage ---\n")
+		}
+		builder.WriteString(passage.Text + "\n")
+	}
+
+	pages, err := ExtractText(source.File)
+	if err != nil || len(pages) == 0 {
+		builder.WriteString("--- description ---\n" + source.File.Description + "\n")
+	}
+	for _, page := range pages {
+		if builder.Len() >= limit {
+			break
+		}
+		if page.Page > 0 {
+			builder.WriteString(fmt.Sprintf("--- page %d ---\n", page.Page))
+		}
+		builder.WriteString(page.Text + "\n")
+	}
+
+	text := builder.String()
+	if len(text) > limit {
+		text = strings.ToValidUTF8(text[:limit], "") + "\n[truncated]"
+	}
+	return text
+}
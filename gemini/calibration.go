@@ -0,0 +1,57 @@
+package gemini
+
+import (
+	"math"
+	"strings"
+)
+
+// DefaultRelevanceThreshold is the minimum calibrated relevance a file needs
+// to be reported as a match when the config does not set one. For
+// text-embedding-004 it matches the raw similarity cut-off of 0.35 used before
+// scores were calibrated.
+const DefaultRelevanceThreshold = 0.1
+
+// scoreCalibration maps the raw cosine similarities of one embedding model
+// onto a 0-1 relevance scale. Floor is the similarity typical of unrelated
+// text and Ceiling that of a close paraphrase.
+type scoreCalibration struct {
+	Floor   float32
+	Ceiling float32
+}
+
+// calibrations holds the similarity ranges of known embedding models. They
+// are meant to make the configured threshold mean the same thing whichever
+// model is used, but none has been measured yet, so a threshold is not
+// known to carry over between models.
+//
+// The text-embedding-004 floor is set so that DefaultRelevanceThreshold
+// falls on the raw 0.35 cut-off search used before scores were calibrated;
+// every other bound is an estimate. TestCalibrationBounds measures them on
+// the labelled pairs in testdata/calibration once recordings of each model
+// are committed there, and fails when a bound here is off.
+var calibrations = map[string]scoreCalibration{
+	"text-embedding-004":   {Floor: 0.30, Ceiling: 0.80},
+	"embedding-001":        {Floor: 0.55, Ceiling: 0.90},
+	"gemini-embedding-001": {Floor: 0.45, Ceiling: 0.85},
+}
+
+// Unknown models are assumed to use the whole cosine range.
+var defaultCalibration = scoreCalibration{Floor: 0, Ceiling: 1}
+
+// Relevance converts a raw cosine similarity produced by model into a
+// relevance between 0 and 1.
+func Relevance(model string, similarity float32) float32 {
+	calibration, ok := calibrations[strings.TrimPrefix(model, "models/")]
+	if !ok {
+		calibration = defaultCalibration
+	}
+
+	relevance := (similarity - calibration.Floor) / (calibration.Ceiling - calibration.Floor)
+	switch {
+	case math.IsNaN(float64(relevance)) || relevance < 0: // NaN from zero vectors counts as irrelevant
+		return 0
+	case relevance > 1:
+		return 1
+	}
+	return relevance
+}
@@ -0,0 +1,88 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gemini_cli_tool/fileinfo"
+)
+
+// calibrationTolerance is how far a measured bound may be from the one in
+// calibrations before the table needs updating.
+const calibrationTolerance = 0.05
+
+// TestCalibrationBounds measures each model's floor and ceiling as the mean
+// similarity of the unrelated and the paraphrased pairs in
+// testdata/calibration/pairs.json, replayed from testdata/calibration/<model>.
+// Models with no recording there are skipped; recording logs the measured
+// bounds, to be copied into calibrations.
+func TestCalibrationBounds(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "calibration", "pairs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs []struct {
+		A, B       string
+		Paraphrase bool
+	}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		t.Fatal(err)
+	}
+
+	models := make([]string, 0, len(calibrations))
+	for model := range calibrations {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	for _, model := range models {
+		t.Run(model, func(t *testing.T) {
+			apiKey := useCassetteDir(t, filepath.Join("testdata", "calibration", model))
+
+			session, err := NewchatSession(context.Background(), apiKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+
+			embeddings := make(map[string][]float32)
+			embed := func(text string) []float32 {
+				if embedding, ok := embeddings[text]; ok {
+					return embedding
+				}
+				embedding, err := GenerateEmbedding(session, text, model)
+				if err != nil {
+					t.Fatalf("embedding %q: %v", text, err)
+				}
+				embeddings[text] = fileinfo.Normalize(embedding)
+				return embeddings[text]
+			}
+
+			var sums, counts [2]float64
+			for _, pair := range pairs {
+				similarity, ok := fileinfo.Similarity(embed(pair.A), embed(pair.B))
+				if !ok {
+					t.Fatalf("%s returned embeddings of different lengths", model)
+				}
+				group := 0
+				if pair.Paraphrase {
+					group = 1
+				}
+				sums[group] += float64(similarity)
+				counts[group]++
+			}
+			floor, ceiling := sums[0]/counts[0], sums[1]/counts[1]
+			t.Logf("measured floor %.3f, ceiling %.3f", floor, ceiling)
+
+			want := calibrations[model]
+			if math.Abs(floor-float64(want.Floor)) > calibrationTolerance || math.Abs(ceiling-float64(want.Ceiling)) > calibrationTolerance {
+				t.Errorf("calibration is {Floor: %.2f, Ceiling: %.2f}, measured {Floor: %.2f, Ceiling: %.2f}", want.Floor, want.Ceiling, floor, ceiling)
+			}
+		})
+	}
+}
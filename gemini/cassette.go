@@ -0,0 +1,254 @@
+package gemini
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gemini_cli_tool/fileinfo"
+)
+
+// Cassette modes select whether the genai client's HTTP traffic is sent to the
+// API as usual, recorded to cassette files, or replayed from them offline.
+const (
+	CassetteOff    = ""
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+
+	cassetteModeEnv = "GENCLI_CASSETTE_MODE"
+	cassetteDirEnv  = "GENCLI_CASSETTE_DIR"
+)
+
+// cassetteInteraction is one recorded request/response pair.
+type cassetteInteraction struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"requestBody"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	ResponseBody string      `json:"responseBody"`
+}
+
+// cassetteTransport records or replays HTTP round trips. Requests are keyed by
+// method, URL and body rather than by order, so concurrent indexing replays
+// deterministically; identical requests are answered in the order recorded.
+type cassetteTransport struct {
+	mode string
+	dir  string
+	base http.RoundTripper
+
+	mu           sync.Mutex
+	interactions map[string][]cassetteInteraction
+	played       map[string]int
+}
+
+var (
+	cassetteMu     sync.Mutex
+	activeCassette *cassetteTransport
+)
+
+// UseCassettes switches every session created afterwards to the given cassette
+// mode. Empty arguments fall back to GENCLI_CASSETTE_MODE and
+// GENCLI_CASSETTE_DIR; the directory defaults to "cassettes" in the config dir.
+func UseCassettes(mode, dir string) error {
+	if mode == "" {
+		mode = os.Getenv(cassetteModeEnv)
+	}
+	if dir == "" {
+		dir = os.Getenv(cassetteDirEnv)
+	}
+
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+
+	switch mode {
+	case CassetteOff:
+		activeCassette = nil
+		return nil
+	case CassetteRecord, CassetteReplay:
+	default:
+		return fmt.Errorf("unknown cassette mode %q (want %q or %q)", mode, CassetteRecord, CassetteReplay)
+	}
+
+	if dir == "" {
+		configDir, err := fileinfo.GetConfigDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(configDir, "cassettes")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	activeCassette = &cassetteTransport{
+		mode:         mode,
+		dir:          dir,
+		base:         http.DefaultTransport,
+		interactions: make(map[string][]cassetteInteraction),
+		played:       make(map[string]int),
+	}
+	return nil
+}
+
+// cassetteHTTPClient returns an HTTP client for the active cassette, or nil
+// when cassettes are off. The API key is added per request and never recorded.
+func cassetteHTTPClient(apiKey string) *http.Client {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+
+	if activeCassette == nil {
+		return nil
+	}
+	return &http.Client{Transport: &apiKeyTransport{apiKey: apiKey, base: activeCassette}}
+}
+
+// apiKeyTransport authenticates requests the way option.WithAPIKey does, which
+// the genai client skips once a custom HTTP client is supplied.
+type apiKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.base.RoundTrip(req)
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	key := cassetteKey(req, body)
+
+	if t.mode == CassetteReplay {
+		return t.replay(req, key)
+	}
+	return t.record(req, key, body)
+}
+
+func (t *cassetteTransport) replay(req *http.Request, key string) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	interactions, ok := t.interactions[key]
+	if !ok {
+		data, err := os.ReadFile(filepath.Join(t.dir, key+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("no recorded response for %s %s in %s: %w", req.Method, redactedURL(req), t.dir, err)
+		}
+		if err := json.Unmarshal(data, &interactions); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %w", key, err)
+		}
+		t.interactions[key] = interactions
+	}
+	if len(interactions) == 0 {
+		return nil, fmt.Errorf("empty cassette %s for %s %s", key, req.Method, redactedURL(req))
+	}
+
+	// Repeated identical requests get the recorded responses in turn, then the last one.
+	n := t.played[key]
+	if n >= len(interactions) {
+		n = len(interactions) - 1
+	}
+	t.played[key]++
+
+	interaction := interactions[n]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(interaction.ResponseBody))),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+func (t *cassetteTransport) record(req *http.Request, key string, body []byte) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := http.Header{}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A recording run replaces whatever an earlier run stored under the same key.
+	t.interactions[key] = append(t.interactions[key], cassetteInteraction{
+		Method:       req.Method,
+		URL:          redactedURL(req),
+		RequestBody:  string(body),
+		Status:       resp.StatusCode,
+		Header:       header,
+		ResponseBody: string(respBody),
+	})
+
+	data, err := json.MarshalIndent(t.interactions[key], "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := fileinfo.WriteFileAtomic(filepath.Join(t.dir, key+".json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write cassette: %w", err)
+	}
+
+	return resp, nil
+}
+
+// cassetteKey identifies a request independently of credentials, of the
+// random boundary used by multipart uploads and of the whitespace protojson
+// varies from one build to the next.
+func cassetteKey(req *http.Request, body []byte) string {
+	if _, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("boundary"))
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", req.Method, redactedURL(req))
+	hash.Write(body)
+	return fmt.Sprintf("%x", hash.Sum(nil))[:32]
+}
+
+// redactedURL returns the request URL without the API key.
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	query.Del("key")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
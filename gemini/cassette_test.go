@@ -0,0 +1,50 @@
+package gemini
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestCassettes replays the package's cassettes in testdata, or records
+// them again when GENCLI_CASSETTE_MODE=record and GEMINI_API_KEY are set. It
+// returns the API key to use, a placeholder when replaying.
+func useTestCassettes(t *testing.T) string {
+	t.Helper()
+	return useCassetteDir(t, filepath.Join("testdata", "cassettes"))
+}
+
+// useCassetteDir is useTestCassettes with the cassettes in dir. When
+// replaying, the test is skipped if nothing has been recorded in dir.
+func useCassetteDir(t *testing.T, dir string) string {
+	t.Helper()
+
+	mode := os.Getenv(cassetteModeEnv)
+	if mode == CassetteOff {
+		mode = CassetteReplay
+	}
+
+	apiKey := "replay"
+	if mode == CassetteRecord {
+		apiKey = os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			t.Skip("recording cassettes needs GEMINI_API_KEY")
+		}
+	}
+
+	if mode == CassetteReplay {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			t.Skipf("nothing recorded in %s; record it with GENCLI_CASSETTE_MODE=record and GEMINI_API_KEY", dir)
+		}
+	}
+
+	if err := UseCassettes(mode, dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cassetteMu.Lock()
+		defer cassetteMu.Unlock()
+		activeCassette = nil
+	})
+	return apiKey
+}
@@ -0,0 +1,64 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gemini_cli_tool/fileinfo"
+
+	"google.golang.org/api/iterator"
+)
+
+func TestChatReplay(t *testing.T) {
+	apiKey := useTestCassettes(t)
+
+	session, err := NewchatSession(context.Background(), apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	// Streamed, as the chat command does
+	var reply strings.Builder
+	responses := session.SendMessageStream("Which shell command lists the files in a directory?")
+	for {
+		resp, err := responses.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("streaming the reply: %v", err)
+		}
+		for _, candidate := range resp.Candidates {
+			if candidate.Content == nil {
+				continue
+			}
+			for _, part := range candidate.Content.Parts {
+				fmt.Fprint(&reply, part)
+			}
+		}
+	}
+	if strings.TrimSpace(reply.String()) == "" {
+		t.Fatal("empty streamed reply")
+	}
+
+	// The second request carries the first turn, so it only replays if the
+	// history was kept
+	resp, err := session.SendMessage("And how do I include hidden files?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, status, reason := responseText(resp); status != fileinfo.StatusOK {
+		t.Fatalf("reply status = %v (%s), text %q", status, reason, text)
+	}
+	if got := len(session.session.History); got != 4 {
+		t.Errorf("history has %d messages, want 4", got)
+	}
+
+	session.ClearHistory()
+	if got := len(session.session.History); got != 0 {
+		t.Errorf("history has %d messages after clearing, want 0", got)
+	}
+}
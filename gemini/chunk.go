@@ -0,0 +1,178 @@
+package gemini
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gemini_cli_tool/fileinfo"
+
+	"github.com/dslipak/pdf"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+)
+
+const (
+	chunkSize         = 1000       // bytes of text per chunk
+	chunkOverlap      = 200        // bytes shared by neighbouring chunks
+	maxChunksPerFile  = 64         // keeps very long documents from draining quota
+	maxExtractedBytes = 256 * 1024 // text read from a single file
+	maxEmbedBatch     = 100        // texts per BatchEmbedContents request
+)
+
+// TextPage is the extracted text of one page of a PDF, or of a whole text
+// file, in which case Page is 0.
+type TextPage struct {
+	Page int
+	Text string
+}
+
+// ExtractText reads the text of a text or PDF file, page by page. Other file
+// types have no extractable text and return nil.
+func ExtractText(file fileinfo.FileInfo) ([]TextPage, error) {
+	filePath := filepath.Join(file.Directory, file.Name)
+	mimeType := mime.TypeByExtension(filepath.Ext(filePath))
+
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		content, err := io.ReadAll(io.LimitReader(f, maxExtractedBytes))
+		if err != nil {
+			return nil, err
+		}
+		return []TextPage{{Text: string(content)}}, nil
+
+	case strings.HasSuffix(mimeType, "/pdf"):
+		r, err := pdf.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		var pages []TextPage
+		var total int
+		fonts := make(map[string]*pdf.Font)
+		for i := 1; i <= r.NumPage() && total < maxExtractedBytes; i++ {
+			p := r.Page(i)
+			if p.V.IsNull() {
+				continue
+			}
+			for _, name := range p.Fonts() {
+				if _, ok := fonts[name]; !ok {
+					f := p.Font(name)
+					fonts[name] = &f
+				}
+			}
+
+			text, err := p.GetPlainText(fonts)
+			if err != nil {
+				return pages, err
+			}
+			pages = append(pages, TextPage{Page: i, Text: text})
+			total += len(text)
+		}
+		return pages, nil
+	}
+
+	return nil, nil
+}
+
+// splitChunks cuts each page into overlapping chunks, preferring to break on
+// whitespace so words are not split across chunks.
+func splitChunks(pages []TextPage) []fileinfo.Chunk {
+	var chunks []fileinfo.Chunk
+
+	for _, page := range pages {
+		text := page.Text
+		start := 0
+		for start < len(text) && len(chunks) < maxChunksPerFile {
+			end := start + chunkSize
+			if end >= len(text) {
+				end = len(text)
+			} else {
+				if cut := strings.LastIndexFunc(text[start+chunkSize/2:end], unicode.IsSpace); cut >= 0 {
+					end = start + chunkSize/2 + cut
+				}
+				for end > start && !utf8.RuneStart(text[end]) {
+					end--
+				}
+			}
+
+			trimmed := strings.TrimLeftFunc(text[start:end], unicode.IsSpace)
+			if passage := strings.TrimRightFunc(trimmed, unicode.IsSpace); passage != "" {
+				offset := end - len(trimmed)
+				chunks = append(chunks, fileinfo.Chunk{Page: page.Page, Offset: offset, Text: passage})
+			}
+
+			if end == len(text) {
+				break
+			}
+
+			next := end - chunkOverlap
+			for next > start && !utf8.RuneStart(text[next]) {
+				next--
+			}
+			if next <= start {
+				next = end
+			}
+			start = next
+		}
+	}
+
+	return chunks
+}
+
+// embedChunks extracts the text of file, splits it into chunks and embeds them
+// in batches. Files without extractable text have no chunks.
+func embedChunks(session *Session, file fileinfo.FileInfo, embeddingModel string) ([]fileinfo.Chunk, error) {
+	pages, err := ExtractText(file)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := splitChunks(pages)
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	em := session.client.EmbeddingModel(embeddingModel)
+	for start := 0; start < len(chunks); start += maxEmbedBatch {
+		end := min(start+maxEmbedBatch, len(chunks))
+
+		batch := em.NewBatch()
+		for _, chunk := range chunks[start:end] {
+			batch.AddContent(genai.Text(chunk.Text))
+		}
+
+		res, err := em.BatchEmbedContents(session.ctx, batch)
+		if err != nil {
+			if apiErr, ok := err.(*apierror.APIError); ok && apiErr.HTTPCode() == http.StatusTooManyRequests {
+				err = retryWithBackoff(func() error {
+					var retryErr error
+					res, retryErr = em.BatchEmbedContents(session.ctx, batch)
+					return retryErr
+				})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i, embedding := range res.Embeddings {
+			if start+i < end && embedding != nil {
+				chunks[start+i].Embedding = embedding.Values
+			}
+		}
+	}
+
+	return chunks, nil
+}
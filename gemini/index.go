@@ -28,9 +28,15 @@ const (
 	maxConcurrentRequests = 10
 	maxTokensPerRequest   = 900000
 	timeOutDuration       = 20 * time.Second
+
+	// DefaultEmbeddingModel is used when the config does not name one.
+	DefaultEmbeddingModel = "text-embedding-004"
 )
 
-func GenerateDescriptions(files []fileinfo.FileInfo, apiKeys []string, hs *fileinfo.HashSet) []fileinfo.FileInfo {
+// GenerateDescriptions describes files in batches, one file per API key.
+// Files whose prompts are blocked or answered empty keep a status explaining
+// why; with retryMetadata they are retried using a metadata-only prompt.
+func GenerateDescriptions(files []fileinfo.FileInfo, apiKeys []string, hs *fileinfo.HashSet, retryMetadata bool) []fileinfo.FileInfo {
 	// Create a buffered writer for the spinner output
 	// writer := bufio.NewWriterSize(os.Stdout, 0)
 	// spinner := fileinfo.NewSpinner(20, 100*time.Millisecond, writer)
@@ -92,23 +98,24 @@ func GenerateDescriptions(files []fileinfo.FileInfo, apiKeys []string, hs *filei
 			for batch := range fileCh {
 				// fmt.Printf("Goroutine %d processing batch", id)
 				var err error
-				resultBatch, err := GenerateBatchDescription(sessions, batch)
+				resultBatch, err := GenerateBatchDescription(sessions, batch, retryMetadata)
 				if err != nil {
 					return
 				}
 
 				for i, file := range batch {
-    if i < len(resultBatch) {
-        file.Description = resultBatch[i].Description
-    } else {
-        fmt.Printf(
-            "⚠️ Mismatch: batch size = %d, but resultBatch size = %d (index %d out of range)\n",
-            len(batch), len(resultBatch), i,
-        )
-        file.Description = "Description unavailable"
-    }
-    resultCh <- file
-}
+					if i < len(resultBatch) {
+						file = resultBatch[i]
+					} else {
+						fmt.Printf(
+							"⚠️ Mismatch: batch size = %d, but resultBatch size = %d (index %d out of range)\n",
+							len(batch), len(resultBatch), i,
+						)
+						file.Description = ""
+						file.Status, file.StatusReason = fileinfo.StatusFailed, "description unavailable"
+					}
+					resultCh <- file
+				}
 
 			}
 			// fmt.Printf("Goroutine %d finished\n", id)
@@ -134,7 +141,7 @@ func GenerateDescriptions(files []fileinfo.FileInfo, apiKeys []string, hs *filei
 	return processedFiles
 }
 
-func GenerateBatchDescription(sessions []*Session, batch []fileinfo.FileInfo) ([]fileinfo.FileInfo, error) {
+func GenerateBatchDescription(sessions []*Session, batch []fileinfo.FileInfo, retryMetadata bool) ([]fileinfo.FileInfo, error) {
 
 	fmt.Print("length of each batch :", len(batch))
 	var resultBatch []fileinfo.FileInfo
@@ -146,49 +153,23 @@ func GenerateBatchDescription(sessions []*Session, batch []fileinfo.FileInfo) ([
 		prompt, err := GeneratePrompt(session, &file)
 		if err != nil {
 			fmt.Printf("Error generating prompt for file %s: %v\n", file.Name, err)
-			file.Description = "nil"
+			file.Description = ""
+			file.Status, file.StatusReason = fileinfo.StatusFailed, err.Error()
+			resultBatch = append(resultBatch, file)
 			continue
 		}
 
-		resp, err := model.GenerateContent(session.ctx, prompt...)
-		if err != nil {
-			fmt.Printf("%w", err.(*apierror.APIError))
-			fmt.Printf("Error generating content from Gemini: %v\n", err)
-			if apiErr, ok := err.(*apierror.APIError); ok {
-				fmt.Printf("\n||%d", apiErr.HTTPCode())
-				if apiErr.HTTPCode() == http.StatusTooManyRequests {
-					err = retryWithBackoff(func() error {
-						var retryErr error
-						resp, retryErr = model.GenerateContent(session.ctx, prompt...)
-						return retryErr
-					})
-					if err != nil {
-						fmt.Printf("Error after retry: %v\n", err)
-						file.Description = "nil"
-						continue
-					}
-				} else {
-					file.Description = "nil"
-					continue
-				}
-			} else {
-				file.Description = "nil"
-				continue
-			}
-		}
-
-		fmt.Print("respose of file ", file.Name, " is ", resp.Candidates[0].Content.Parts[0])
-		if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
-			var builder strings.Builder
+		describeFile(session, model, &file, prompt)
 
-			for _, candidate := range resp.Candidates {
-				for _, part := range candidate.Content.Parts {
-					builder.WriteString(fmt.Sprintf("%s", part))
-				}
+		// Blocked content can often still be described from its name, size and date alone.
+		if retryMetadata && (file.Status == fileinfo.StatusBlocked || file.Status == fileinfo.StatusEmpty) {
+			reason := file.StatusReason
+			metadataPrompt, _ := getDefaultPrompt(file)
+			describeFile(session, model, &file, metadataPrompt)
+			if file.Status == fileinfo.StatusOK {
+				file.Status = fileinfo.StatusMetadataOnly
+				file.StatusReason = reason
 			}
-			file.Description = builder.String()
-		} else {
-			file.Description = "nil"
 		}
 
 		resultBatch = append(resultBatch, file)
@@ -197,6 +178,30 @@ func GenerateBatchDescription(sessions []*Session, batch []fileinfo.FileInfo) ([
 	return resultBatch, nil
 }
 
+// describeFile sends prompt to the model and records on file either the
+// generated description or the status and reason explaining why there is none.
+func describeFile(session *Session, model *genai.GenerativeModel, file *fileinfo.FileInfo, prompt []genai.Part) {
+	resp, err := model.GenerateContent(session.ctx, prompt...)
+	if err != nil {
+		if apiErr, ok := err.(*apierror.APIError); ok && apiErr.HTTPCode() == http.StatusTooManyRequests {
+			err = retryWithBackoff(func() error {
+				var retryErr error
+				resp, retryErr = model.GenerateContent(session.ctx, prompt...)
+				return retryErr
+			})
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Error generating content from Gemini for file %s: %v\n", file.Name, err)
+		file.Description = ""
+		file.Status, file.StatusReason = errorStatus(err)
+		return
+	}
+
+	file.Description, file.Status, file.StatusReason = responseText(resp)
+}
+
 func GeneratePrompt(session *Session, file *fileinfo.FileInfo) ([]genai.Part, error) {
 
 	filePath := filepath.Join(file.Directory, file.Name)
@@ -266,7 +271,7 @@ func getDefaultPrompt(file fileinfo.FileInfo) ([]genai.Part, error) {
 
 	// model := session.client.GenerativeModel("gemini-2.5-flash")
 	prompt := []genai.Part{
-		genai.Text(fmt.Sprintf("Using your comprehensive knowledge, generate a detailed and informative description in less than 200 words that accurately summarizes the content and purpose of this file. Consider all available metadata and context to provide insights into what this file is, its potential use, and its significance. Use the following metadata to guide your description:\n\n- File Id: %d\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\nPlease ensure the description is concise yet thorough.", file.Id, filePath, file.Size, file.ModifiedTime)),
+		genai.Text(fmt.Sprintf("Using your comprehensive knowledge, generate a detailed and informative description in less than 200 words that accurately summarizes the content and purpose of this file. Consider all available metadata and context to provide insights into what this file is, its potential use, and its significance. Use the following metadata to guide your description:\n\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\nPlease ensure the description is concise yet thorough.", filePath, file.Size, file.ModifiedTime)),
 	}
 
 	return prompt, nil
@@ -299,8 +304,8 @@ func handleTextFile(file fileinfo.FileInfo) ([]genai.Part, error) {
 	// Create the prompt using the snippet
 	prompt := []genai.Part{
 		genai.Text(fmt.Sprintf(
-			"Using the provided text snippet, generate a detailed and insightful description in less than 200 words that captures the essence, purpose, and key topics of this file.\n\nFile Id: %d\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\nPlease ensure the description is concise yet thorough.\n\nContent Snippet: \n\n%s\n\nIf relevant, infer the file's broader context or potential uses.",
-			file.Id, filePath, file.Size, file.ModifiedTime, contentSnippet)),
+			"Using the provided text snippet, generate a detailed and insightful description in less than 200 words that captures the essence, purpose, and key topics of this file.\n\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\nPlease ensure the description is concise yet thorough.\n\nContent Snippet: \n\n%s\n\nIf relevant, infer the file's broader context or potential uses.",
+			filePath, file.Size, file.ModifiedTime, contentSnippet)),
 	}
 
 	return prompt, nil
@@ -336,7 +341,7 @@ func handlePdfFile(file fileinfo.FileInfo) ([]genai.Part, error) {
 
 	// Create the prompt using the snippet
 	prompt := []genai.Part{
-		genai.Text(fmt.Sprintf("From the provided PDF content snippet, generate an in-depth description in less than 200 words that highlights the main themes, purpose, and possible applications of this document. File Id: %dd\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n. Content Snippet: \n\n%s\n\nAdditionally, consider the document's structure or any inferred context.", file.Id, filePath, file.Size, file.ModifiedTime, contentSnippet)),
+		genai.Text(fmt.Sprintf("From the provided PDF content snippet, generate an in-depth description in less than 200 words that highlights the main themes, purpose, and possible applications of this document.\n\n- File Path: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n. Content Snippet: \n\n%s\n\nAdditionally, consider the document's structure or any inferred context.", filePath, file.Size, file.ModifiedTime, contentSnippet)),
 	}
 	// fmt.Println(prompt[0])
 	return prompt, nil
@@ -393,7 +398,7 @@ func processUploadedImage(file fileinfo.FileInfo, uploadedFile *genai.File) ([]g
 
 	prompt := []genai.Part{
 		genai.FileData{URI: uploadedFile.URI},
-		genai.Text(fmt.Sprintf("Generate a rich and detailed description in less than 200 words about the subject, context, and potential significance of this image file. Consider its visual elements, style, and possible context. File Id: %d\n- File Name: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n", file.Id, file.Name, file.Size, file.ModifiedTime)),
+		genai.Text(fmt.Sprintf("Generate a rich and detailed description in less than 200 words about the subject, context, and potential significance of this image file. Consider its visual elements, style, and possible context.\n\n- File Name: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n", file.Name, file.Size, file.ModifiedTime)),
 	}
 
 	return prompt, nil
@@ -497,14 +502,17 @@ func processUploadedVideo(file fileinfo.FileInfo, uploadedFile *genai.File) ([]g
 	// model := session.client.GenerativeModel("gemini-2.5-flash")
 	prompt := []genai.Part{
 		genai.FileData{URI: uploadedFile.URI},
-		genai.Text(fmt.Sprintf("Generate a well-rounded description in less than 200 words about what this video file likely depicts and its possible purpose. Use your knowledge to interpret the content and any associated metadata. The file Id is %d\n- File Name: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n", file.Id, file.Name, file.Size, file.ModifiedTime)),
+		genai.Text(fmt.Sprintf("Generate a well-rounded description in less than 200 words about what this video file likely depicts and its possible purpose. Use your knowledge to interpret the content and any associated metadata.\n\n- File Name: %s\n- File Size: %d bytes\n- Last Modified: %v\n\n", file.Name, file.Size, file.ModifiedTime)),
 	}
 
 	return prompt, nil
 
 }
 
-func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string) []fileinfo.FileInfo {
+// GenerateEmbeddings embeds the description and the text chunks of each file
+// with embeddingModel and records the model on the file, so a later model
+// change can be detected.
+func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string, embeddingModel string) []fileinfo.FileInfo {
 
 	ctx := context.Background()
 
@@ -535,8 +543,17 @@ func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string) []filei
 			for file := range fileCh {
 				// fmt.Printf("Goroutine %d processing file: %s\n", id, file.Name)
 
+				// Files without a description are kept out of search entirely.
+				if !file.HasDescription() {
+					file.Embedding = nil
+					file.EmbeddingModel = ""
+					file.Chunks = nil
+					resultCh <- file
+					continue
+				}
+
 				var err error
-				file.Embedding, err = GenerateEmbedding(session, file.Description)
+				file.Embedding, err = GenerateEmbedding(session, file.Description, embeddingModel)
 				if err != nil {
 					// fmt.Printf("%w", err.(*apierror.APIError))
 					if apiErr, ok := err.(*apierror.APIError); ok {
@@ -544,7 +561,7 @@ func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string) []filei
 						if apiErr.HTTPCode() == http.StatusTooManyRequests {
 							err = retryWithBackoff(func() error {
 								var retryErr error
-								file.Embedding, retryErr = GenerateEmbedding(session, file.Description)
+								file.Embedding, retryErr = GenerateEmbedding(session, file.Description, embeddingModel)
 								return retryErr
 							})
 
@@ -558,6 +575,19 @@ func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string) []filei
 						file.Embedding = nil
 					}
 				}
+				if file.Embedding != nil {
+					file.EmbeddingModel = embeddingModel
+
+					// Passages of the extracted text are embedded alongside the description
+					file.Chunks, err = embedChunks(session, file, embeddingModel)
+					if err != nil {
+						file.Chunks = nil
+					}
+					file.NormalizeEmbeddings()
+				} else {
+					file.EmbeddingModel = ""
+					file.Chunks = nil
+				}
 				resultCh <- file
 			}
 			// fmt.Printf("Goroutine %d finished\n", id)
@@ -575,9 +605,9 @@ func GenerateEmbeddings(files []fileinfo.FileInfo, defaultApiKey string) []filei
 	return processedFiles
 }
 
-func GenerateEmbedding(chatSession *Session, desc string) ([]float32, error) {
+func GenerateEmbedding(chatSession *Session, desc string, embeddingModel string) ([]float32, error) {
 
-	em := chatSession.client.EmbeddingModel("text-embedding-004")
+	em := chatSession.client.EmbeddingModel(embeddingModel)
 	embeddingResult, err := em.EmbedContent(chatSession.ctx, genai.Text(desc))
 	if err != nil {
 		return nil, err
@@ -0,0 +1,66 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gemini_cli_tool/fileinfo"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Files per group shown to the model when asking for folder names.
+const maxNamingSamples = 8
+
+// NameFolders asks the model for a short folder name describing each group of
+// files, returned in the same order as groups.
+func NameFolders(groups [][]fileinfo.FileInfo, defaultApiKey string) ([]string, error) {
+	ctx := context.Background()
+
+	session, err := NewchatSession(ctx, defaultApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	model := session.client.GenerativeModel("gemini-2.5-flash")
+	model.ResponseMIMEType = "application/json"
+
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("The files below have been sorted into %d groups. ", len(groups)))
+	prompt.WriteString("Suggest a short, human-friendly folder name (at most 4 words, no slashes) for each group that describes what its files have in common. ")
+	prompt.WriteString(fmt.Sprintf("Every name must be different. Reply with only a JSON array of %d strings, one per group, in order.\n", len(groups)))
+
+	for i, group := range groups {
+		prompt.WriteString(fmt.Sprintf("\nGroup %d (%d files):\n", i+1, len(group)))
+		for j, file := range group {
+			if j == maxNamingSamples {
+				prompt.WriteString(fmt.Sprintf("- and %d more\n", len(group)-j))
+				break
+			}
+			prompt.WriteString(fmt.Sprintf("- %s: %s\n", file.Name, truncateText(file.Description, 200)))
+		}
+	}
+
+	resp, err := model.GenerateContent(ctx, genai.Text(prompt.String()))
+	if err != nil {
+		_, reason := errorStatus(err)
+		return nil, fmt.Errorf("failed to name folders : %s", reason)
+	}
+
+	text, status, reason := responseText(resp)
+	if status != fileinfo.StatusOK {
+		return nil, fmt.Errorf("failed to name folders : %s", reason)
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(text), &names); err != nil {
+		return nil, fmt.Errorf("failed to parse folder names : %w", err)
+	}
+	if len(names) != len(groups) {
+		return nil, fmt.Errorf("model returned %d folder names for %d groups", len(names), len(groups))
+	}
+
+	return names, nil
+}
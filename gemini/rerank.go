@@ -0,0 +1,102 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gemini_cli_tool/fileinfo"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Characters of each candidate's description and passage sent for re-ranking.
+const maxRerankText = 600
+
+// RerankCandidate is a search result offered to the model for re-ranking.
+// Passage is the matched text chunk, if any.
+type RerankCandidate struct {
+	File    fileinfo.FileInfo
+	Passage string
+}
+
+// Reranked is a candidate's place in the model's ordering, with the model's
+// one-line reason for it. Index refers to the slice given to RerankCandidates.
+type Reranked struct {
+	Index  int
+	Reason string
+}
+
+// RerankCandidates asks the chat model to order candidates by how well they
+// answer query and to justify each place in one line. Candidates the model
+// leaves out keep their original order after the ones it ranked.
+func RerankCandidates(query string, candidates []RerankCandidate, defaultApiKey string) ([]Reranked, error) {
+	ctx := context.Background()
+
+	session, err := NewchatSession(ctx, defaultApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	model := session.client.GenerativeModel("gemini-2.5-flash")
+	model.ResponseMIMEType = "application/json"
+
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("A user searched their files for: %q\n\n", query))
+	prompt.WriteString("Rank the candidate files below from most to least relevant to that search, judging by what each file contains rather than by shared words. ")
+	prompt.WriteString(`Reply with only a JSON array of objects {"file": <candidate number>, "reason": "<one short sentence on why it does or does not match>"}, most relevant first, covering every candidate.` + "\n")
+
+	for i, candidate := range candidates {
+		prompt.WriteString(fmt.Sprintf("\nCandidate %d: %s\nDescription: %s\n", i+1, candidate.File.Name, truncateText(candidate.File.Description, maxRerankText)))
+		if candidate.Passage != "" {
+			prompt.WriteString(fmt.Sprintf("Matched passage: %s\n", truncateText(candidate.Passage, maxRerankText)))
+		}
+	}
+
+	resp, err := model.GenerateContent(ctx, genai.Text(prompt.String()))
+	if err != nil {
+		_, reason := errorStatus(err)
+		return nil, fmt.Errorf("re-ranking failed : %s", reason)
+	}
+
+	text, status, reason := responseText(resp)
+	if status != fileinfo.StatusOK {
+		return nil, fmt.Errorf("re-ranking failed : %s", reason)
+	}
+
+	var ranked []struct {
+		File   int    `json:"file"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(text), &ranked); err != nil {
+		return nil, fmt.Errorf("failed to parse re-ranking : %w", err)
+	}
+
+	seen := make(map[int]bool)
+	var order []Reranked
+	for _, r := range ranked {
+		i := r.File - 1
+		if i < 0 || i >= len(candidates) || seen[i] {
+			continue
+		}
+		seen[i] = true
+		order = append(order, Reranked{Index: i, Reason: strings.TrimSpace(r.Reason)})
+	}
+	for i := range candidates {
+		if !seen[i] {
+			order = append(order, Reranked{Index: i})
+		}
+	}
+
+	return order, nil
+}
+
+// truncateText collapses whitespace and cuts text to at most limit bytes.
+func truncateText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > limit {
+		text = strings.ToValidUTF8(text[:limit], "") + "..."
+	}
+	return text
+}
@@ -0,0 +1,84 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gemini_cli_tool/fileinfo"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// responseText extracts the generated description from resp. When the model
+// did not produce usable text the returned status says why, with a reason
+// built from the finish reason and safety ratings.
+func responseText(resp *genai.GenerateContentResponse) (string, fileinfo.DescriptionStatus, string) {
+	if resp == nil {
+		return "", fileinfo.StatusEmpty, "no response from model"
+	}
+
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+		return "", fileinfo.StatusBlocked, fmt.Sprintf("prompt blocked: %s%s", resp.PromptFeedback.BlockReason, safetySummary(resp.PromptFeedback.SafetyRatings))
+	}
+
+	if len(resp.Candidates) == 0 {
+		return "", fileinfo.StatusEmpty, "no candidates returned"
+	}
+
+	var builder strings.Builder
+	for _, candidate := range resp.Candidates {
+		if candidate.FinishReason == genai.FinishReasonSafety || candidate.FinishReason == genai.FinishReasonRecitation {
+			return "", fileinfo.StatusBlocked, fmt.Sprintf("response blocked: %s%s", candidate.FinishReason, safetySummary(candidate.SafetyRatings))
+		}
+		if candidate.Content == nil {
+			continue
+		}
+		for _, part := range candidate.Content.Parts {
+			builder.WriteString(fmt.Sprintf("%s", part))
+		}
+	}
+
+	description := strings.TrimSpace(builder.String())
+	if description == "" {
+		return "", fileinfo.StatusEmpty, fmt.Sprintf("no text returned (finish reason: %s)", resp.Candidates[0].FinishReason)
+	}
+
+	return description, fileinfo.StatusOK, ""
+}
+
+// errorStatus maps an error from GenerateContent to a description status.
+// The genai client reports blocked prompts and candidates as *genai.BlockedError.
+func errorStatus(err error) (fileinfo.DescriptionStatus, string) {
+	var blockedErr *genai.BlockedError
+	if errors.As(err, &blockedErr) {
+		if blockedErr.PromptFeedback != nil {
+			return fileinfo.StatusBlocked, fmt.Sprintf("prompt blocked: %s%s", blockedErr.PromptFeedback.BlockReason, safetySummary(blockedErr.PromptFeedback.SafetyRatings))
+		}
+		if blockedErr.Candidate != nil {
+			return fileinfo.StatusBlocked, fmt.Sprintf("response blocked: %s%s", blockedErr.Candidate.FinishReason, safetySummary(blockedErr.Candidate.SafetyRatings))
+		}
+		return fileinfo.StatusBlocked, blockedErr.Error()
+	}
+
+	return fileinfo.StatusFailed, err.Error()
+}
+
+// safetySummary lists the harm categories that caused a block, or that were
+// rated medium or high, as " (category: probability, ...)".
+func safetySummary(ratings []*genai.SafetyRating) string {
+	var flagged []string
+	for _, rating := range ratings {
+		if rating == nil {
+			continue
+		}
+		if rating.Blocked || rating.Probability >= genai.HarmProbabilityMedium {
+			flagged = append(flagged, fmt.Sprintf("%s: %s", rating.Category, rating.Probability))
+		}
+	}
+
+	if len(flagged) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(flagged, ", ") + ")"
+}
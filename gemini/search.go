@@ -2,63 +2,328 @@ package gemini
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"gemini_cli_tool/fileinfo"
-	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrEmbeddingMismatch is returned when no indexed embedding can be compared
+// with the query, because every file was embedded with another model or dimension.
+var ErrEmbeddingMismatch = errors.New("indexed embeddings do not match the embedding model; run 'gencli index --reembed'")
+
+// ErrNoConfidentMatch is returned, together with the nearest candidates, when
+// no file reaches the relevance threshold.
+var ErrNoConfidentMatch = errors.New("no confident match")
+
+// SearchResult is an indexed file matched by a query. Similarity is the raw
+// cosine score and Relevance its calibrated 0-1 value for the file's embedding
+// model. Passage is set when one of the file's text chunks matched better than
+// its description.
+type SearchResult struct {
+	Index      int
+	Similarity float32
+	Relevance  float32
+	Passage    *fileinfo.Chunk
+}
 
-	"github.com/google/generative-ai-go/genai"
+// EmbeddingLoader fills in the embeddings and chunks of files read without them.
+type EmbeddingLoader func(files []*fileinfo.FileInfo) error
+
+const (
+	// Below this many files a linear scan is as fast as the graph and exact.
+	annMinFiles = 2000
+	// Fewest vectors fetched from the graph per query.
+	annCandidates = 400
+	// Files wanted from the graph when the caller sets no limit.
+	annDefaultResults = 100
 )
 
-func SearchRelevantFiles(files []fileinfo.FileInfo, query string, relevanceIndex float32, defaultApiKey string) (int, error) {
+// SearchRelevantFiles ranks files by calibrated relevance to query and returns
+// up to limit of those reaching relevanceIndex, best first. When none does, it
+// returns the nearest candidates along with ErrNoConfidentMatch. For large
+// indexes, files embedded with embeddingModel are looked up in graph instead
+// of being scanned; graph may be nil.
+//
+// Files may be passed without their embeddings and chunks, in which case
+// loadEmbeddings is called for the ones needed: the files scanned and the
+// graph's candidates. It may be nil when files carry their embeddings.
+//
+// Problems that do not stop the search, such as files skipped for another
+// embedding model, are passed to warn, or written to stderr if it is nil.
+func SearchRelevantFiles(files []fileinfo.FileInfo, query string, relevanceIndex float32, embeddingModel string, limit int, graph *fileinfo.VectorIndex, loadEmbeddings EmbeddingLoader, warn func(message string), defaultApiKey string) ([]SearchResult, error) {
 	ctx := context.Background()
 
 	chatSession, err := NewchatSession(ctx, defaultApiKey)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	em := chatSession.client.EmbeddingModel("text-embedding-004")
-	res, err := em.EmbedContent(ctx, genai.Text(query))
+	queryEmbedding, err := GenerateEmbedding(chatSession, query, embeddingModel)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
+	queryEmbedding = fileinfo.Normalize(queryEmbedding)
+
+	// Files embedded by an older model are compared against a query embedded
+	// by that same model; models that can no longer be used are skipped.
+	queryEmbeddings := map[string][]float32{embeddingModel: queryEmbedding}
+	var compared, mismatched int
+
+	var results []SearchResult
 
-	queryEmbedding := res.Embedding.Values
+	useGraph := graph != nil && graph.Model == embeddingModel && graph.Dim == len(queryEmbedding) && len(files) >= annMinFiles
+	if useGraph {
+		want := limit
+		if want <= 0 {
+			want = annDefaultResults
+		}
+		results, err = graphResults(files, graph, queryEmbedding, embeddingModel, want, loadEmbeddings)
+		if err != nil {
+			return nil, err
+		}
 
-	// var results []int
-	var result int = -1
+		// A narrow filter can leave too few of the graph's neighbours; scan instead
+		useGraph = len(results) >= want
+		if useGraph {
+			compared += len(results)
+		} else {
+			results = nil
+		}
+	}
 
-	var maxSimilarity float32 = 0.0
+	// Files the graph does not cover are scanned
+	var scanned []int
+	var unloaded []*fileinfo.FileInfo
 	for i, file := range files {
-		similarity := cosineSimilarity(file.Embedding, queryEmbedding)
+		if !file.HasDescription() || file.EmbeddedWith() == "" {
+			continue
+		}
+		if useGraph && file.EmbeddedWith() == embeddingModel {
+			continue
+		}
+		scanned = append(scanned, i)
+		if len(file.Embedding) == 0 {
+			unloaded = append(unloaded, &files[i])
+		}
+	}
+	if len(unloaded) > 0 && loadEmbeddings != nil {
+		if err := loadEmbeddings(unloaded); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range scanned {
+		file := files[i]
+		if len(file.Embedding) == 0 {
+			continue
+		}
+
+		model := file.EmbeddedWith()
+		modelEmbedding, ok := queryEmbeddings[model]
+		if !ok {
+			modelEmbedding, err = GenerateEmbedding(chatSession, query, model)
+			if err != nil {
+				modelEmbedding = nil
+			}
+			modelEmbedding = fileinfo.Normalize(modelEmbedding)
+			queryEmbeddings[model] = modelEmbedding
+		}
+
+		if len(modelEmbedding) != len(file.Embedding) {
+			mismatched++
+			continue
+		}
+		compared++
+
+		similarity, passage := bestSimilarity(&files[i], modelEmbedding)
 
 		// fmt.Printf("\n||Similarity With %s : %f||\n", file.Name, similarity)
 
-		if similarity > maxSimilarity && file.Description != "" {
-			maxSimilarity = similarity
-			result = i
+		results = append(results, SearchResult{Index: i, Similarity: similarity, Relevance: Relevance(model, similarity), Passage: passage})
+	}
+
+	if mismatched > 0 {
+		if compared == 0 {
+			return nil, ErrEmbeddingMismatch
+		}
+		message := fmt.Sprintf("%d files were skipped because their embeddings do not match %s; run 'gencli index --reembed'", mismatched, embeddingModel)
+		if warn != nil {
+			warn(message)
+		} else {
+			fmt.Fprintln(os.Stderr, fileinfo.Yellow("\n"+message))
 		}
-		// if similarity > relevanceIndex {
-		// 	results = append(results, i)
-		// }
 	}
 
-	// return results, nil
-	if maxSimilarity > 0.35 {
-		return result, nil
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Relevance > results[b].Relevance
+	})
+
+	confident := 0
+	for confident < len(results) && results[confident].Relevance >= relevanceIndex {
+		confident++
 	}
 
-	return -1, nil
+	if confident == 0 {
+		if limit > 0 && len(results) > limit {
+			results = results[:limit]
+		}
+		return results, ErrNoConfidentMatch
+	}
+
+	results = results[:confident]
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
 }
 
-// Error handling for cosine similarity.---olama, lamaindex ,external packages
-func cosineSimilarity(vec1 []float32, vec2 []float32) float32 {
-	var dotProduct, normVec1, normVec2 float32
+// SimilarFiles ranks files by how close they are to target, using the
+// embeddings already stored, so no API call is made. Only files embedded with
+// the same model as target can be compared; target itself, identified by its
+// path, is left out. Up to limit results are returned, best first (0 for all).
+func SimilarFiles(files []fileinfo.FileInfo, target fileinfo.FileInfo, limit int, graph *fileinfo.VectorIndex) ([]SearchResult, error) {
+	model := target.EmbeddedWith()
+	if model == "" {
+		return nil, fmt.Errorf("%s has no embedding", target.Name)
+	}
+	targetPath := filepath.Join(target.Directory, target.Name)
 
-	for i := range vec1 {
-		dotProduct += vec1[i] * vec2[i]
-		normVec1 += vec1[i] * vec1[i]
-		normVec2 += vec2[i] * vec2[i]
+	want := limit
+	if want <= 0 {
+		want = annDefaultResults
+	}
+	// The target itself is among its nearest neighbours
+	want++
+
+	var results []SearchResult
+	if graph != nil && graph.Model == model && graph.Dim == len(target.Embedding) && len(files) >= annMinFiles {
+		var err error
+		results, err = graphResults(files, graph, target.Embedding, model, want, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Graph results are already one per file; scan when too few are left
+	if len(results) < want {
+		results = nil
+		for i, file := range files {
+			if !file.HasDescription() || file.EmbeddedWith() != model || len(file.Embedding) != len(target.Embedding) {
+				continue
+			}
+
+			similarity, passage := bestSimilarity(&files[i], target.Embedding)
+			results = append(results, SearchResult{Index: i, Similarity: similarity, Relevance: Relevance(model, similarity), Passage: passage})
+		}
+	}
+
+	similar := results[:0]
+	for _, result := range results {
+		file := files[result.Index]
+		if filepath.Join(file.Directory, file.Name) != targetPath {
+			similar = append(similar, result)
+		}
+	}
+	if len(similar) == 0 {
+		return nil, fmt.Errorf("no other indexed files were embedded with %s", model)
+	}
+
+	sort.Slice(similar, func(a, b int) bool {
+		return similar[a].Relevance > similar[b].Relevance
+	})
+	if limit > 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return similar, nil
+}
+
+// bestSimilarity compares the normalised vector with the file's description
+// embedding and each of its chunks, returning the best score and the chunk that produced
+// it, if any.
+func bestSimilarity(file *fileinfo.FileInfo, vector []float32) (float32, *fileinfo.Chunk) {
+	similarity, _ := fileinfo.Similarity(file.Embedding, vector)
+	var passage *fileinfo.Chunk
+
+	// A passage deep inside the file may match better than the description;
+	// chunks whose embedding call failed have none and are skipped
+	for j := range file.Chunks {
+		if chunkSimilarity, ok := fileinfo.Similarity(file.Chunks[j].Embedding, vector); ok && chunkSimilarity > similarity {
+			similarity = chunkSimilarity
+			passage = &file.Chunks[j]
+		}
+	}
+
+	return similarity, passage
+}
+
+// graphResults looks up the nearest neighbours of queryEmbedding in graph and
+// keeps the best-matching vector of each file in files, aiming for want
+// files. Graph nodes are matched to files by ID. Chunks are loaded for the
+// matched files only, to show their passages. No results are returned when
+// files are too few of the graph's for a lookup to beat scanning them.
+func graphResults(files []fileinfo.FileInfo, graph *fileinfo.VectorIndex, queryEmbedding []float32, embeddingModel string, want int, loadEmbeddings EmbeddingLoader) ([]SearchResult, error) {
+	fileIndex := make(map[int]int, len(files))
+	for i, file := range files {
+		if file.Id != 0 && file.HasDescription() && file.EmbeddedWith() == embeddingModel {
+			fileIndex[file.Id] = i
+		}
+	}
+
+	// Each file has a vector per chunk, and a filter leaves only some of the
+	// graph's files, so proportionally more vectors are fetched
+	graphFiles := max(graph.Files(), 1)
+	perFile := float64(graph.Len()) / float64(graphFiles)
+	share := min(float64(len(fileIndex))/float64(graphFiles), 1)
+	if share == 0 {
+		return nil, nil
+	}
+	candidates := max(int(float64(want)*perFile/share), annCandidates)
+	if candidates > graph.Len()/2 {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	var results []SearchResult
+	var chunks []int
+	var unloaded []*fileinfo.FileInfo
+	matches, err := graph.Search(queryEmbedding, candidates)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		i, ok := fileIndex[match.FileID]
+		if !ok {
+			continue
+		}
+
+		// Matches arrive best first, so the first one seen for a file is its best
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+
+		results = append(results, SearchResult{Index: i, Similarity: match.Similarity, Relevance: Relevance(embeddingModel, match.Similarity)})
+		chunks = append(chunks, match.Chunk)
+		if match.Chunk >= 0 && len(files[i].Embedding) == 0 {
+			unloaded = append(unloaded, &files[i])
+		}
+	}
+
+	if len(unloaded) > 0 && loadEmbeddings != nil {
+		if err := loadEmbeddings(unloaded); err != nil {
+			return nil, err
+		}
+	}
+	for r, chunk := range chunks {
+		if file := &files[results[r].Index]; chunk >= 0 && chunk < len(file.Chunks) {
+			results[r].Passage = &file.Chunks[chunk]
+		}
 	}
 
-	return dotProduct / (float32(math.Sqrt(float64(normVec1))) * float32(math.Sqrt(float64(normVec2))))
+	return results, nil
 }
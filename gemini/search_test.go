@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gemini_cli_tool/fileinfo"
+)
+
+func TestSearchRelevantFilesReplay(t *testing.T) {
+	apiKey := useTestCassettes(t)
+
+	session, err := NewchatSession(context.Background(), apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	descriptions := []struct{ name, description string }{
+		{"invoice-2024-031.pdf", "An invoice from a plumbing company for repairing a leaking kitchen pipe, with the amount due and the payment deadline."},
+		{"beach.jpg", "A holiday photo of a sandy beach at sunset, with palm trees and people swimming in the sea."},
+		{"server.go", "Go source code for an HTTP server that routes requests and serves static files."},
+	}
+	files := make([]fileinfo.FileInfo, len(descriptions))
+	for i, d := range descriptions {
+		embedding, err := GenerateEmbedding(session, d.description, DefaultEmbeddingModel)
+		if err != nil {
+			t.Fatalf("embedding %s: %v", d.name, err)
+		}
+		files[i] = fileinfo.FileInfo{
+			Name:           d.name,
+			Directory:      "docs",
+			Description:    d.description,
+			Embedding:      fileinfo.Normalize(embedding),
+			EmbeddingModel: DefaultEmbeddingModel,
+			Status:         fileinfo.StatusOK,
+		}
+	}
+
+	const query = "unpaid plumbing invoice"
+
+	results, err := SearchRelevantFiles(files, query, 0, DefaultEmbeddingModel, 0, nil, nil, nil, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("got %d results, want %d", len(results), len(files))
+	}
+	if got := files[results[0].Index].Name; got != "invoice-2024-031.pdf" {
+		t.Errorf("best match is %s, want invoice-2024-031.pdf", got)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Relevance > results[i-1].Relevance {
+			t.Errorf("result %d is more relevant than result %d", i, i-1)
+		}
+	}
+
+	// With a threshold no file can reach, the nearest candidates still come back
+	results, err = SearchRelevantFiles(files, query, 1.1, DefaultEmbeddingModel, 2, nil, nil, nil, apiKey)
+	if !errors.Is(err, ErrNoConfidentMatch) {
+		t.Fatalf("err = %v, want ErrNoConfidentMatch", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("got %d candidates, want the limit of 2", len(results))
+	}
+
+	// Files embedded with another dimension cannot be compared at all
+	mismatched := []fileinfo.FileInfo{files[0]}
+	mismatched[0].Embedding = mismatched[0].Embedding[:8]
+	if _, err := SearchRelevantFiles(mismatched, query, 0, DefaultEmbeddingModel, 0, nil, nil, nil, apiKey); !errors.Is(err, ErrEmbeddingMismatch) {
+		t.Errorf("err = %v, want ErrEmbeddingMismatch", err)
+	}
+}
@@ -15,7 +15,14 @@ type Session struct {
 
 func NewchatSession(ctx context.Context, apiKey string) (*Session, error) {
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	// The API key stays among the options even with a cassette client, as
+	// genai drops the HTTP client when it creates its cache client
+	clientOptions := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if httpClient := cassetteHTTPClient(apiKey); httpClient != nil {
+		clientOptions = append(clientOptions, option.WithHTTPClient(httpClient))
+	}
+
+	client, err := genai.NewClient(ctx, clientOptions...)
 	if err != nil {
 		return nil, err
 	}
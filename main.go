@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"gemini_cli_tool/cli"
 	"gemini_cli_tool/fileinfo"
+	"gemini_cli_tool/gemini"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -17,11 +19,8 @@ const (
 func run() int {
 	// fmt.Println("run..")
 
-	hashSet := fileinfo.NewHashSet() // Initialize the hash set
-	// Load the hash set from file at the start
-	if err := hashSet.LoadFromFile(); err != nil {
-		return 1
-	}
+	// Loaded by the commands that use it, once they hold the config directory lock
+	hashSet := fileinfo.NewHashSet()
 
 	rootCmd := &cobra.Command{
 		Use:   "gencli",
@@ -42,24 +41,42 @@ This versatile command-line interface is designed to enhance your file managemen
 		},
 	}
 
+	var cassetteMode, cassetteDir string
+	rootCmd.PersistentFlags().StringVar(&cassetteMode, "cassette", "", "Record or replay Gemini API traffic (record, replay); defaults to $GENCLI_CASSETTE_MODE")
+	rootCmd.PersistentFlags().StringVar(&cassetteDir, "cassette-dir", "", "Directory holding cassette files; defaults to $GENCLI_CASSETTE_DIR or the config directory")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return gemini.UseCassettes(cassetteMode, cassetteDir)
+	}
+
 	// These functions need to written :
 	rootCmd.AddCommand(cli.NewConfigCommand())
 	rootCmd.AddCommand(cli.NewIndexCommand(hashSet))
 	rootCmd.AddCommand(cli.NewSearchCommand())
+	rootCmd.AddCommand(cli.NewSearchesCommand())
+	rootCmd.AddCommand(cli.NewSimilarCommand())
+	rootCmd.AddCommand(cli.NewAskCommand())
+	rootCmd.AddCommand(cli.NewDupesCommand())
+	rootCmd.AddCommand(cli.NewOrganizeCommand(hashSet))
 	rootCmd.AddCommand(cli.NewChatCommand())
 
+	// Errors are printed below, to stderr, so scripts can keep stdout clean
+	rootCmd.SilenceErrors = true
+
 	err := rootCmd.Execute()
-	if err != nil {
-		fmt.Println(fileinfo.Red(err.Error()))
-		return 1
+	if errors.Is(err, cli.ErrNoMatch) {
+		fmt.Fprintln(os.Stderr, fileinfo.Yellow(err.Error()))
+		return cli.ExitNoMatch
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, fileinfo.Red(err.Error()))
+		return cli.ExitError
 	}
 
 	// Save the hash set to file at the end
-	if err := hashSet.SaveToFile(); err != nil {
+	if err := hashSet.Save(); err != nil {
 		fmt.Println(fileinfo.Red(fmt.Sprintf("\nError saving hash set: %v\n\nPlease Config First\n", err)))
 	}
 
-	return 0
+	return cli.ExitOK
 
 }
 
@@ -0,0 +1,19 @@
+module github.com/googleapis/gax-go/v2
+
+go 1.20
+
+require (
+	github.com/google/go-cmp v0.6.0
+	google.golang.org/api v0.188.0
+	google.golang.org/genproto/googleapis/api v0.0.0-20240711142825-46eb208f015d
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240711142825-46eb208f015d
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+
+)
+
+require (
+	golang.org/x/net v0.27.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)